@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"demo/internal/generator"
+)
+
+// coordinate serves a distributed run until every instance has reported or
+// GEN_COORDINATOR_TIMEOUT passes, then logs and writes the merged report.
+func coordinate(ctx context.Context, cfg generator.Config) error {
+	runID := fmt.Sprintf("%s-%d", cfg.ClientID, time.Now().UnixNano())
+	coord := generator.NewCoordinator(runID, cfg)
+
+	ln, err := net.Listen("tcp", cfg.CoordinatorAddr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	srv := &http.Server{Handler: coord.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("coordinator server failed", "error", err)
+		}
+	}()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	slog.Info("coordinating run", "run_id", runID, "addr", ln.Addr().String(), "instances", cfg.Instances,
+		"rate", cfg.MessageRate, "schedule", cfg.RateSchedule, "total", cfg.TotalMessages)
+
+	waitCtx, cancel := context.WithTimeout(ctx, cfg.CoordinatorTimeout)
+	defer cancel()
+	report, waitErr := coord.Wait(waitCtx)
+	args := []any{
+		"run_id", runID,
+		"instances", len(report.Instances),
+		"produced", report.Produced,
+		"acked", report.Acked,
+		"errors", report.Errors,
+		"seconds", report.Seconds,
+	}
+	if report.Seconds > 0 {
+		args = append(args, "avg_rate", float64(int(float64(report.Produced)/report.Seconds*10))/10)
+	}
+	for _, p := range []string{"p50", "p99", "max"} {
+		if v, ok := report.AckLatencyMS[p]; ok {
+			args = append(args, "ack_latency_ms_"+p, v)
+		}
+	}
+	slog.Info("coordinated run finished", args...)
+
+	if cfg.ReportFile != "" {
+		if err := generator.WriteReport(cfg.ReportFile, cfg.ReportFormat, report); err != nil {
+			slog.Error("write run report", "path", cfg.ReportFile, "error", err)
+		} else {
+			slog.Info("run report written", "path", cfg.ReportFile, "format", cfg.ReportFormat)
+		}
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	if v := report.Verification; v != nil && !v.Passed() {
+		return fmt.Errorf("verification failed: %d missing, %d duplicated, %d leaked", v.Missing, v.Duplicated, v.Leaked)
+	}
+	return nil
+}
+
+// join registers with the coordinator and applies the assignment to cfg.
+func join(ctx context.Context, cfg *generator.Config) (*generator.Assignment, error) {
+	slog.Info("joining coordinated run", "coordinator", cfg.CoordinatorURL, "id", cfg.InstanceID)
+	a, err := generator.Register(ctx, cfg.CoordinatorURL, cfg.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.Apply(cfg); err != nil {
+		return nil, err
+	}
+	slog.Info("joined coordinated run", "run_id", a.RunID, "instance", a.Instance, "of", a.Instances,
+		"total_messages", cfg.TotalMessages, "start_at", a.StartAt)
+	return &a, nil
+}
+
+// waitForStart sleeps until the coordinated start time.
+func waitForStart(ctx context.Context, a *generator.Assignment) {
+	d := time.Until(a.StartAt)
+	if d <= 0 {
+		slog.Warn("coordinated start already passed", "start_at", a.StartAt, "late", -d)
+		return
+	}
+	slog.Info("waiting for coordinated start", "start_at", a.StartAt, "in", d.Round(time.Millisecond))
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -2,116 +2,369 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"math/rand"
+	"io"
+	"log/slog"
+	"math"
 	"os"
 	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/IBM/sarama"
-	"golang.org/x/time/rate"
 
 	"demo/internal/generator"
+	"demo/internal/logging"
 )
 
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
-
 	cfg, err := generator.FromEnv()
 	if err != nil {
-		log.Fatalf("load generator config: %v", err)
+		fatal("load generator config", err)
+	}
+
+	logger, err := logging.New(os.Stdout, logging.Options{
+		Format:       cfg.LogFormat,
+		Level:        cfg.LogLevel,
+		RepeatLimit:  cfg.LogRepeatLimit,
+		RepeatWindow: cfg.LogRepeatWindow,
+	})
+	if err != nil {
+		fatal("init logging", err)
 	}
+	slog.SetDefault(logger)
 
 	if cfg.MessageRate <= 0 {
-		log.Fatalf("GEN_MESSAGE_RATE must be > 0")
+		fatal("invalid config", fmt.Errorf("GEN_MESSAGE_RATE must be > 0"))
 	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if cfg.Mode == generator.ModeCoordinate {
+		if err := coordinate(ctx, cfg); err != nil {
+			fatal("coordinate", err, "addr", cfg.CoordinatorAddr)
+		}
+		return
+	}
+	var assignment *generator.Assignment
+	if cfg.CoordinatorURL != "" {
+		if assignment, err = join(ctx, &cfg); err != nil {
+			fatal("join coordinated run", err, "coordinator", cfg.CoordinatorURL)
+		}
+	}
+
 	saramaCfg := sarama.NewConfig()
 	saramaCfg.ClientID = cfg.ClientID
-	saramaCfg.Producer.RequiredAcks = sarama.WaitForLocal
+	saramaCfg.Producer.RequiredAcks = parseAcks(cfg.Acks)
 	saramaCfg.Producer.Return.Errors = true
+	if cfg.Idempotent {
+		saramaCfg.Producer.Idempotent = true
+		saramaCfg.Net.MaxOpenRequests = 1
+	}
+	saramaCfg.Producer.Transaction.ID = cfg.TransactionalID
+	// Verification needs the partition and offset of every acknowledged
+	// message, the run report and the coordinator their ack latency.
+	saramaCfg.Producer.Return.Successes = cfg.Verify || cfg.ReportFile != "" || assignment != nil
 
 	version, err := sarama.ParseKafkaVersion(cfg.KafkaVersion)
 	if err != nil {
-		log.Fatalf("parse kafka version %q: %v", cfg.KafkaVersion, err)
+		fatal("parse kafka version", err, "version", cfg.KafkaVersion)
 	}
 	saramaCfg.Version = version
 
 	if codec, err := parseCompression(cfg.Compression); err != nil {
-		log.Fatalf("compression: %v", err)
+		fatal("compression", err)
 	} else {
 		saramaCfg.Producer.Compression = codec
 	}
 
+	if cfg.Mode == generator.ModeCapture {
+		if err := capture(ctx, cfg, saramaCfg); err != nil {
+			fatal("capture", err, "path", cfg.CaptureFile)
+		}
+		return
+	}
+
+	var src source
+	if cfg.Mode == generator.ModeReplay {
+		src, err = newReplaySource(cfg)
+	} else {
+		src, err = newSyntheticSource(ctx, cfg)
+	}
+	if err != nil {
+		fatal("init source", err, "mode", cfg.Mode)
+	}
+	defer src.close()
+
 	producer, err := sarama.NewAsyncProducer(cfg.Brokers, saramaCfg)
 	if err != nil {
-		log.Fatalf("create producer: %v", err)
+		fatal("create producer", err)
 	}
 
+	if assignment != nil {
+		waitForStart(ctx, assignment)
+	}
+	recorder := generator.NewRecorder()
 	var errorCount int64
 	errorsDone := make(chan struct{})
 	go func() {
 		for err := range producer.Errors() {
 			atomic.AddInt64(&errorCount, 1)
-			log.Printf("produce error: %v", err)
+			recorder.Failed(err.Err)
+			slog.Warn("produce error", "topic", err.Msg.Topic, "error", err.Err)
 		}
 		close(errorsDone)
 	}()
 
-	limiter := rate.NewLimiter(rate.Limit(cfg.MessageRate), cfg.MessageRate)
-	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	runID := fmt.Sprintf("%s-%d", cfg.ClientID, time.Now().UnixNano())
+	if assignment != nil {
+		runID = fmt.Sprintf("%s-%d", assignment.RunID, assignment.Instance)
+	}
+	var verifier *generator.Verifier
+	successesDone := make(chan struct{})
+	if cfg.Verify {
+		verifier = generator.NewVerifier(runID, cfg.VerifyTable)
+	}
+	if saramaCfg.Producer.Return.Successes {
+		go func() {
+			for msg := range producer.Successes() {
+				info, _ := msg.Metadata.(sendInfo)
+				recorder.Acked(info.sent)
+				if verifier != nil {
+					verifier.Ack(msg.Topic, msg.Partition, msg.Offset, info.txn, info.aborted)
+				}
+			}
+			close(successesDone)
+		}()
+	} else {
+		close(successesDone)
+	}
+	txns := newTransactions(producer, cfg, verifier)
+	slog.Info("starting run", "run_id", runID, "mode", cfg.Mode, "verify", cfg.Verify,
+		"acks", cfg.Acks, "idempotent", cfg.Idempotent, "transactional", txns != nil)
+	if cfg.Mode == generator.ModeGenerate && len(cfg.Topics) > 1 {
+		slog.Info("fanning out", "topics", cfg.Topics)
+	}
+	// Replays keep their captured headers unless verification needs the run
+	// headers to find the rows again.
+	stamp := cfg.Mode == generator.ModeGenerate || cfg.Verify
+
 	var produced int64
+	if cfg.MetricsAddr != "" {
+		gauges := append(src.gauges(), txns.gauges()...)
+		gauges = append(gauges,
+			generator.Gauge{Name: "generator_produced_total", Read: func() float64 { return float64(atomic.LoadInt64(&produced)) }},
+			generator.Gauge{Name: "generator_errors_total", Read: func() float64 { return float64(atomic.LoadInt64(&errorCount)) }},
+		)
+		go generator.ServeMetrics(ctx, cfg.MetricsAddr, gauges)
+	}
 	nextLog := time.Now().Add(cfg.LogInterval)
 	start := time.Now()
 
 loop:
 	for {
 		if cfg.TotalMessages > 0 && produced >= int64(cfg.TotalMessages) {
-			log.Printf("completed sending %d messages", produced)
+			slog.Info("completed sending messages", "produced", produced)
 			break
 		}
 
-		if err := limiter.Wait(ctx); err != nil {
-			log.Printf("limiter stopped: %v", err)
-			break
+		// Instances of a coordinated run interleave their sequence numbers.
+		seq := produced*int64(cfg.Instances) + int64(cfg.Instance) + 1
+		msg, err := src.next(ctx, seq)
+		switch {
+		case errors.Is(err, io.EOF):
+			slog.Info("no more messages", "mode", cfg.Mode, "produced", produced)
+			break loop
+		case ctx.Err() != nil:
+			slog.Info("limiter stopped", "error", ctx.Err())
+			break loop
+		case err != nil:
+			slog.Error("next message", "mode", cfg.Mode, "seq", seq, "error", err)
+			break loop
+		}
+		if stamp {
+			msg.Headers = append(msg.Headers,
+				sarama.RecordHeader{Key: []byte(generator.HeaderRunID), Value: []byte(runID)},
+				sarama.RecordHeader{Key: []byte(generator.HeaderSeq), Value: []byte(strconv.FormatInt(seq, 10))},
+				sarama.RecordHeader{Key: []byte(generator.HeaderProducedAt), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+			)
 		}
 
-		seq := atomic.AddInt64(&produced, 1)
-		key := fmt.Sprintf("%s-%d", cfg.KeyPrefix, seq)
-		value := buildPayload(random, seq, cfg.MessageSize)
-
-		msg := &sarama.ProducerMessage{
-			Topic: cfg.Topic,
-			Key:   sarama.StringEncoder(key),
-			Value: sarama.ByteEncoder(value),
+		txn, aborted, err := txns.begin()
+		if err != nil {
+			slog.Error("transaction failed", "error", err)
+			break
 		}
+		// Read back from the producer's successes.
+		msg.Metadata = sendInfo{sent: time.Now(), txn: txn, aborted: aborted}
 
 		select {
 		case producer.Input() <- msg:
+			atomic.AddInt64(&produced, 1)
+			recorder.Produced()
 		case <-ctx.Done():
-			log.Printf("context cancelled; stopping")
+			slog.Info("context cancelled; stopping")
 			break loop
 		}
+		if err := txns.sentOne(); err != nil {
+			slog.Error("transaction failed", "error", err)
+			break
+		}
 
 		if time.Now().After(nextLog) {
 			elapsed := time.Since(start).Seconds()
 			avgRate := float64(produced) / elapsed
-			log.Printf("produced=%d errors=%d avg_rate=%.1f msg/s goroutines=%d", produced, atomic.LoadInt64(&errorCount), avgRate, runtime.NumGoroutine())
+			args := []any{
+				"produced", produced,
+				"errors", atomic.LoadInt64(&errorCount),
+				"avg_rate", math.Round(avgRate*10) / 10,
+			}
+			args = append(args, src.progress()...)
+			args = append(args, txns.progress()...)
+			slog.Info("progress", append(args, "goroutines", runtime.NumGoroutine())...)
 			nextLog = time.Now().Add(cfg.LogInterval)
 		}
 	}
 
+	// A partial transaction still commits, or aborts if it was picked to.
+	if err := txns.end(); err != nil {
+		slog.Error("transaction failed", "error", err)
+	}
 	producer.AsyncClose()
 	<-errorsDone
-	log.Printf("producer closed (%d messages sent, %d errors)", produced, atomic.LoadInt64(&errorCount))
+	<-successesDone
+	slog.Info("producer closed", append([]any{"produced", produced, "errors", atomic.LoadInt64(&errorCount)}, txns.progress()...)...)
+
+	var verification *generator.Report
+	if verifier != nil {
+		stop()
+		verification = verify(cfg, verifier)
+	}
+	if cfg.ReportFile != "" {
+		report := recorder.Report(runID, cfg)
+		report.Verification = verification
+		if err := generator.WriteReport(cfg.ReportFile, cfg.ReportFormat, report); err != nil {
+			slog.Error("write run report", "path", cfg.ReportFile, "error", err)
+		} else {
+			slog.Info("run report written", "path", cfg.ReportFile, "format", cfg.ReportFormat)
+		}
+	}
+	if assignment != nil {
+		report := recorder.InstanceReport(assignment.Instance, runID, cfg)
+		report.Report.Verification = verification
+		submitCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := generator.SubmitReport(submitCtx, cfg.CoordinatorURL, report); err != nil {
+			slog.Error("report to coordinator", "coordinator", cfg.CoordinatorURL, "error", err)
+		}
+		cancel()
+	}
+	if verifier != nil && (verification == nil || !verification.Passed()) {
+		os.Exit(1)
+	}
+}
+
+// sendInfo travels with each message as its Metadata.
+type sendInfo struct {
+	sent    time.Time
+	txn     int64
+	aborted bool
+}
+
+// capture dumps the configured topic range into the capture file. It reads
+// committed records only, like the worker, so aborted transactions are not
+// replayed later.
+func capture(ctx context.Context, cfg generator.Config, saramaCfg *sarama.Config) error {
+	saramaCfg.Consumer.IsolationLevel = sarama.ReadCommitted
+	client, err := sarama.NewClient(cfg.Brokers, saramaCfg)
+	if err != nil {
+		return fmt.Errorf("create client: %w", err)
+	}
+	defer client.Close()
+
+	file, err := os.Create(cfg.CaptureFile)
+	if err != nil {
+		return fmt.Errorf("create capture file: %w", err)
+	}
+	defer file.Close()
+	writer, err := generator.NewRecordWriter(file, cfg.CaptureFormat)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	written, err := generator.Capture(ctx, client, generator.CaptureOptions{
+		Topic:      cfg.Topic,
+		Partitions: cfg.CapturePartitions,
+		Start:      cfg.CaptureStart,
+		End:        cfg.CaptureEnd,
+		Limit:      int64(cfg.TotalMessages),
+	}, writer)
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("sync capture file: %w", err)
+	}
+	slog.Info("capture complete", "path", cfg.CaptureFile, "format", cfg.CaptureFormat,
+		"records", written, "elapsed", time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+// verify waits for the run to land in Postgres and logs the outcome. A second
+// interrupt abandons the wait, which returns nil.
+func verify(cfg generator.Config, verifier *generator.Verifier) *generator.Report {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := verifier.Verify(ctx, cfg.VerifyDSN, cfg.VerifyPollInterval, cfg.VerifyTimeout)
+	if err != nil {
+		slog.Error("verification aborted", "error", err)
+		return nil
+	}
+	args := []any{
+		"run_id", report.RunID,
+		"acked", report.Acked,
+		"delivered", report.Delivered,
+		"missing", report.Missing,
+		"duplicated", report.Duplicated,
+		"unacked", report.Unacked,
+		"aborted", report.Aborted,
+		"leaked", report.Leaked,
+		"waited", report.Waited.Round(time.Millisecond),
+	}
+	for _, p := range []string{"p50", "p90", "p99", "max"} {
+		if d, ok := report.Latency[p]; ok {
+			args = append(args, "latency_"+p, d.Round(time.Millisecond))
+		}
+	}
+	if !report.Passed() {
+		slog.Error("verification failed", args...)
+		return &report
+	}
+	slog.Info("verification passed", args...)
+	return &report
+}
+
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, "error", err)...)
+	os.Exit(1)
+}
+
+func parseAcks(value string) sarama.RequiredAcks {
+	switch value {
+	case generator.AcksNone:
+		return sarama.NoResponse
+	case generator.AcksAll:
+		return sarama.WaitForAll
+	default:
+		return sarama.WaitForLocal
+	}
 }
 
 func parseCompression(value string) (sarama.CompressionCodec, error) {
@@ -130,28 +383,3 @@ func parseCompression(value string) (sarama.CompressionCodec, error) {
 		return sarama.CompressionNone, fmt.Errorf("unsupported compression codec %q", value)
 	}
 }
-
-func buildPayload(r *rand.Rand, seq int64, size int) []byte {
-	ts := time.Now().UTC().Format(time.RFC3339Nano)
-	header := fmt.Sprintf("{\"id\":%d,\"ts\":\"%s\",\"payload\":\"", seq, ts)
-	footer := "\"}"
-	fillerLen := size - len(header) - len(footer)
-	if fillerLen < 0 {
-		fillerLen = 0
-	}
-	filler := randomAlphaNumeric(r, fillerLen)
-	return []byte(header + filler + footer)
-}
-
-var alphaNumeric = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
-
-func randomAlphaNumeric(r *rand.Rand, n int) string {
-	if n <= 0 {
-		return ""
-	}
-	b := make([]rune, n)
-	for i := range b {
-		b[i] = alphaNumeric[r.Intn(len(alphaNumeric))]
-	}
-	return string(b)
-}
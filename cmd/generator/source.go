@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"demo/internal/generator"
+)
+
+// source yields the messages of a run.
+type source interface {
+	// next blocks until message seq is due and returns it; io.EOF ends the run.
+	next(ctx context.Context, seq int64) (*sarama.ProducerMessage, error)
+	// progress returns source-specific fields for the progress log.
+	progress() []any
+	gauges() []generator.Gauge
+	close() error
+}
+
+// syntheticSource builds messages from keys, headers and a payload template
+// or random filler, fanned out over the configured topics and paced by the
+// rate schedule.
+type syntheticSource struct {
+	cfg     generator.Config
+	pacer   *generator.Pacer
+	topics  *generator.TopicPicker
+	keys    generator.KeySource
+	headers *generator.HeaderSet
+	payload *generator.PayloadTemplate
+	encoder generator.Encoder
+	random  *rand.Rand
+}
+
+func newSyntheticSource(ctx context.Context, cfg generator.Config) (*syntheticSource, error) {
+	s := &syntheticSource{cfg: cfg, random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	var err error
+	if s.keys, err = generator.NewKeySource(cfg, s.random); err != nil {
+		return nil, fmt.Errorf("init key source: %w", err)
+	}
+	if s.headers, err = generator.ParseHeaders(cfg.Headers, s.random); err != nil {
+		return nil, fmt.Errorf("GEN_HEADERS: %w", err)
+	}
+	if _, err := s.headers.Render(0, "", cfg.Topics[0].Name); err != nil {
+		return nil, fmt.Errorf("GEN_HEADERS: %w", err)
+	}
+	s.topics = generator.NewTopicPicker(cfg.Topics, s.random)
+	if s.encoder, err = generator.NewEncoder(ctx, cfg, s.random); err != nil {
+		return nil, err
+	}
+	if cfg.PayloadTemplate != "" {
+		if s.payload, err = generator.LoadPayloadTemplate(cfg.PayloadTemplate, s.random, cfg.MessageSize); err != nil {
+			return nil, err
+		}
+		sample, err := s.payload.Render(0, "", cfg.Topics[0].Name)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case s.encoder != nil:
+			// Schema encodings need the template to fit the schema.
+			if _, err := s.encoder.Encode(cfg.Topics[0].Name, sample); err != nil {
+				return nil, fmt.Errorf("payload template: %w", err)
+			}
+		case !json.Valid(sample):
+			slog.Warn("payload template does not render valid JSON", "path", cfg.PayloadTemplate)
+		}
+	}
+	s.pacer = generator.NewPacer(cfg.Schedule)
+	return s, nil
+}
+
+func (s *syntheticSource) next(ctx context.Context, seq int64) (*sarama.ProducerMessage, error) {
+	more, err := s.pacer.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !more {
+		return nil, io.EOF
+	}
+
+	topic := s.topics.Pick()
+	key := s.keys.Next(seq)
+	var value []byte
+	if s.payload != nil {
+		if value, err = s.payload.Render(seq, key, topic); err != nil {
+			return nil, err
+		}
+	} else if s.encoder == nil {
+		value = generator.DefaultPayload(s.random, seq, s.cfg.MessageSize)
+	}
+	if s.encoder != nil {
+		// Without a template the encoder fills the schema itself.
+		if value, err = s.encoder.Encode(topic, value); err != nil {
+			return nil, err
+		}
+	}
+	headers, err := s.headers.Render(seq, key, topic)
+	if err != nil {
+		return nil, err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	}
+	for _, h := range headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	return msg, nil
+}
+
+func (s *syntheticSource) progress() []any {
+	phase := s.pacer.PhaseIndex() + 1
+	// A burst has no rate (+Inf), which encoding/json cannot log.
+	if target := s.pacer.TargetRate(); !math.IsInf(target, 1) {
+		return []any{"target_rate", math.Round(target*10) / 10, "phase", phase}
+	}
+	return []any{"burst", true, "phase", phase}
+}
+
+func (s *syntheticSource) gauges() []generator.Gauge {
+	return []generator.Gauge{
+		{Name: "generator_target_rate", Read: func() float64 {
+			if target := s.pacer.TargetRate(); !math.IsInf(target, 1) {
+				return target
+			}
+			return 0
+		}},
+		{Name: "generator_burst", Read: func() float64 {
+			if math.IsInf(s.pacer.TargetRate(), 1) {
+				return 1
+			}
+			return 0
+		}},
+		{Name: "generator_phase", Read: func() float64 { return float64(s.pacer.PhaseIndex()) }},
+	}
+}
+
+func (s *syntheticSource) close() error { return nil }
+
+// replaySource produces the records of a capture file.
+type replaySource struct {
+	topic    string
+	file     *os.File
+	replayer *generator.Replayer
+}
+
+func newReplaySource(cfg generator.Config) (*replaySource, error) {
+	file, err := os.Open(cfg.CaptureFile)
+	if err != nil {
+		return nil, fmt.Errorf("open capture file: %w", err)
+	}
+	reader, err := generator.NewRecordReader(file, cfg.CaptureFormat)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	slog.Info("replaying capture", "path", cfg.CaptureFile, "format", cfg.CaptureFormat, "speed", cfg.ReplaySpeed)
+	return &replaySource{topic: cfg.Topic, file: file, replayer: generator.NewReplayer(reader, cfg.ReplaySpeed)}, nil
+}
+
+func (s *replaySource) next(ctx context.Context, _ int64) (*sarama.ProducerMessage, error) {
+	rec, err := s.replayer.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msg := &sarama.ProducerMessage{Topic: s.topic}
+	// Keep null keys and values null rather than empty.
+	if rec.Key != nil {
+		msg.Key = sarama.ByteEncoder(rec.Key)
+	}
+	if rec.Value != nil {
+		msg.Value = sarama.ByteEncoder(rec.Value)
+	}
+	for _, h := range rec.Headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: h.Key, Value: h.Value})
+	}
+	return msg, nil
+}
+
+func (s *replaySource) progress() []any           { return nil }
+func (s *replaySource) gauges() []generator.Gauge { return nil }
+func (s *replaySource) close() error              { return s.file.Close() }
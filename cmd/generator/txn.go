@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"demo/internal/generator"
+)
+
+// transactions groups produced messages into transactions of a fixed size
+// and aborts a configured fraction of them. A nil *transactions is a
+// non-transactional producer.
+type transactions struct {
+	producer  sarama.AsyncProducer
+	size      int
+	abortRate float64
+	random    *rand.Rand
+	// verifier, when set, learns about transactions whose commit failed.
+	verifier *generator.Verifier
+
+	open  bool
+	abort bool
+	sent  int
+	// id numbers the open transaction from 1.
+	id int64
+
+	committed atomic.Int64
+	aborted   atomic.Int64
+	failed    atomic.Int64
+}
+
+func newTransactions(producer sarama.AsyncProducer, cfg generator.Config, verifier *generator.Verifier) *transactions {
+	if !producer.IsTransactional() {
+		return nil
+	}
+	return &transactions{
+		producer:  producer,
+		size:      cfg.TxnSize,
+		abortRate: cfg.TxnAbortRate,
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		verifier:  verifier,
+	}
+}
+
+// begin opens a transaction if none is open and returns the number of the
+// transaction the next message belongs to (0 without transactions) and
+// whether it will be aborted.
+func (t *transactions) begin() (int64, bool, error) {
+	if t == nil {
+		return 0, false, nil
+	}
+	if !t.open {
+		if err := t.producer.BeginTxn(); err != nil {
+			return 0, false, fmt.Errorf("begin transaction: %w", err)
+		}
+		t.open, t.sent = true, 0
+		t.id++
+		t.abort = t.random.Float64() < t.abortRate
+	}
+	return t.id, t.abort, nil
+}
+
+// sentOne counts a message and ends the transaction once it is full.
+func (t *transactions) sentOne() error {
+	if t == nil {
+		return nil
+	}
+	t.sent++
+	if t.sent < t.size {
+		return nil
+	}
+	return t.end()
+}
+
+// end commits or aborts the open transaction. A commit that fails with an
+// abortable error is aborted instead, counted as failed and reported to the
+// verifier, so its messages are not expected in the table; any other failure
+// leaves the producer unusable and is returned.
+func (t *transactions) end() error {
+	if t == nil || !t.open {
+		return nil
+	}
+	t.open = false
+	if t.abort {
+		if err := t.producer.AbortTxn(); err != nil {
+			return fmt.Errorf("abort transaction: %w", err)
+		}
+		t.aborted.Add(1)
+		return nil
+	}
+	err := t.producer.CommitTxn()
+	if err == nil {
+		t.committed.Add(1)
+		return nil
+	}
+	if t.producer.TxnStatus()&sarama.ProducerTxnFlagAbortableError == 0 {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	slog.Warn("commit failed; aborting transaction", "messages", t.sent, "error", err)
+	if err := t.producer.AbortTxn(); err != nil {
+		return fmt.Errorf("abort failed transaction: %w", err)
+	}
+	if t.verifier != nil {
+		t.verifier.MarkAborted(t.id)
+	}
+	t.failed.Add(1)
+	return nil
+}
+
+func (t *transactions) progress() []any {
+	if t == nil {
+		return nil
+	}
+	return []any{
+		"txn_committed", t.committed.Load(),
+		"txn_aborted", t.aborted.Load(),
+		"txn_failed", t.failed.Load(),
+	}
+}
+
+func (t *transactions) gauges() []generator.Gauge {
+	if t == nil {
+		return nil
+	}
+	return []generator.Gauge{
+		{Name: "generator_txn_committed_total", Read: func() float64 { return float64(t.committed.Load()) }},
+		{Name: "generator_txn_aborted_total", Read: func() float64 { return float64(t.aborted.Load()) }},
+		{Name: "generator_txn_failed_total", Read: func() float64 { return float64(t.failed.Load()) }},
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"demo/internal/generator"
+)
+
+// txnProducer is a transactional producer whose commits fail with commitErr.
+type txnProducer struct {
+	sarama.AsyncProducer
+	commitErr error
+	aborts    int
+}
+
+func (p *txnProducer) IsTransactional() bool { return true }
+func (p *txnProducer) BeginTxn() error       { return nil }
+func (p *txnProducer) CommitTxn() error      { return p.commitErr }
+func (p *txnProducer) AbortTxn() error       { p.aborts++; return nil }
+
+func (p *txnProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	if p.commitErr != nil {
+		return sarama.ProducerTxnFlagInTransaction | sarama.ProducerTxnFlagAbortableError
+	}
+	return sarama.ProducerTxnFlagReady
+}
+
+func TestFailedCommitIsNotReportedMissing(t *testing.T) {
+	producer := &txnProducer{commitErr: errors.New("kafka server: producer fenced")}
+	verifier := generator.NewVerifier("run", "events")
+	txns := newTransactions(producer, generator.Config{TxnSize: 3}, verifier)
+
+	// send produces one message and acknowledges it unless late is set.
+	var offset int64
+	send := func(late bool) (int64, bool) {
+		txn, aborted, err := txns.begin()
+		if err != nil {
+			t.Fatalf("begin transaction: %v", err)
+		}
+		if !late {
+			verifier.Ack("orders", 0, offset, txn, aborted)
+		}
+		offset++
+		if err := txns.sentOne(); err != nil {
+			t.Fatalf("end transaction: %v", err)
+		}
+		return txn, aborted
+	}
+
+	// The first transaction fails to commit; its last acknowledgement
+	// arrives after the abort.
+	send(false)
+	send(false)
+	failed, aborted := send(true)
+	verifier.Ack("orders", 0, offset-1, failed, aborted)
+	if producer.aborts != 1 || txns.failed.Load() != 1 {
+		t.Fatalf("want the failed commit aborted once, have %d aborts and %d failed", producer.aborts, txns.failed.Load())
+	}
+
+	// The second one commits.
+	producer.commitErr = nil
+	for i := 0; i < 3; i++ {
+		send(false)
+	}
+	if txns.committed.Load() != 1 {
+		t.Fatalf("want 1 committed transaction, have %d", txns.committed.Load())
+	}
+
+	// Only the committed transaction reaches the table, so with its three
+	// rows delivered nothing is missing.
+	if have := verifier.Acked(); have != 3 {
+		t.Errorf("want 3 messages expected in the table, have %d (missing %d)", have, have-3)
+	}
+}
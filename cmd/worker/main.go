@@ -3,58 +3,257 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"demo/internal/admin"
 	"demo/internal/config"
 	"demo/internal/consumer"
+	"demo/internal/health"
+	"demo/internal/logging"
 	"demo/internal/metrics"
+	"demo/internal/pipeline"
 	"demo/internal/storage"
+	"demo/internal/tracing"
 	"demo/internal/worker"
 )
 
 func main() {
-	cfg, err := config.FromEnv()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(configCommand(os.Args[2:]))
+	}
+
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	_ = flags.Parse(os.Args[1:])
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("load config", err)
+	}
+
+	logger, err := logging.New(os.Stdout, logging.Options{
+		Format:       cfg.LogFormat,
+		Level:        cfg.LogLevel,
+		RepeatLimit:  cfg.LogRepeatLimit,
+		RepeatWindow: cfg.LogRepeatWindow,
+	})
 	if err != nil {
-		log.Fatalf("load config: %v", err)
+		fatal("init logging", err)
 	}
+	slog.SetDefault(logger)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TraceExporter, cfg.TraceServiceName)
+	if err != nil {
+		fatal("init tracing", err)
+	}
+
 	collector := &metrics.Collector{}
-	go metrics.Serve(ctx, cfg.MetricsAddr, collector)
 
 	writer, err := storage.NewPostgresWriter(ctx, cfg.DBURL, cfg.DBTable, cfg.DBMaxConns, cfg.DBMaxConnLifetime, cfg.DBMaxConnIdleTime)
 	if err != nil {
-		log.Fatalf("connect postgres: %v", err)
+		fatal("connect postgres", err)
+	}
+
+	pipe, err := pipeline.New(cfg, writer, collector)
+	if err != nil {
+		fatal("init pipeline", err)
+	}
+	pool, faults := pipe.Pool, pipe.Chaos
+
+	// Writes and consumption outlive the signal; shutdown stops them in order.
+	pool.Start(context.Background())
+
+	runner, err := consumer.NewRunner(ctx, cfg, pool, collector)
+	if err != nil {
+		fatal("init consumer", err)
+	}
+
+	reload := func() (worker.Tuning, error) {
+		return reloadTuning(*configPath, pool)
+	}
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if _, err := reload(); err != nil {
+					slog.Error("reload config on SIGHUP", "error", err)
+				}
+			}
+		}
+	}()
+
+	mounts := []metrics.Mount{probes(cfg, writer, runner, pool)}
+	if cfg.AdminToken != "" {
+		api := &admin.API{Token: cfg.AdminToken, Runner: runner, Pool: pool, Collector: collector, Reload: reload, Chaos: faults}
+		mounts = append(mounts, api.Mount)
+	} else {
+		slog.Warn("ADMIN_TOKEN not set; admin api disabled")
+	}
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	defer stopServing()
+	go metrics.Serve(serveCtx, cfg.MetricsAddr, collector, mounts...)
+
+	consumeCtx, stopConsuming := context.WithCancel(context.Background())
+	runDone := make(chan error, 1)
+	go func() { runDone <- runner.Run(consumeCtx) }()
+
+	select {
+	case <-ctx.Done():
+		slog.Info("shutdown requested", "grace_period", cfg.ShutdownGracePeriod)
+	case err := <-runDone:
+		slog.Error("runner terminated", "error", err)
+		runDone <- err
+	}
+	shutdown(cfg.ShutdownGracePeriod, runner, stopConsuming, runDone, pool, writer, shutdownTracing)
+}
+
+// shutdown stops fetching, drains the pool, commits the offsets it marked and
+// then closes the consumer group, the Postgres pool and the trace exporter,
+// all within grace. Steps that could not finish are logged; whatever was not
+// written is re-read from the last commit after restart.
+func shutdown(grace time.Duration, runner *consumer.Runner, stopConsuming context.CancelFunc, runDone <-chan error,
+	pool *worker.Pool, writer *storage.PostgresWriter, shutdownTracing func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	started := time.Now()
+	undone := 0
+
+	runner.StopFetching()
+
+	drained := pool.Drain(ctx)
+	if drained.TimedOut {
+		undone++
+		slog.Warn("pool drain timed out; in-flight writes cancelled", "elapsed", drained.Elapsed)
+	}
+	if drained.Discarded > 0 || drained.Unfinished > 0 {
+		slog.Warn("jobs left unwritten; they will be re-read after restart", "discarded", drained.Discarded, "unfinished", drained.Unfinished)
+	}
+
+	if !runner.Commit() {
+		undone++
+		slog.Warn("no active session; final offsets not committed")
+	}
+
+	stopConsuming()
+	select {
+	case err := <-runDone:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("runner terminated", "error", err)
+		}
+	case <-ctx.Done():
+		undone++
+		slog.Warn("consumer group session did not end before the deadline")
+	}
+	if err := runner.Close(); err != nil {
+		undone++
+		slog.Warn("close consumer group", "error", err)
+	}
+
+	writer.Close()
+
+	flushCtx := ctx
+	if ctx.Err() != nil {
+		// Grace period spent: give the exporter one short last attempt.
+		var cancelFlush context.CancelFunc
+		flushCtx, cancelFlush = context.WithTimeout(context.Background(), time.Second)
+		defer cancelFlush()
+	}
+	if err := shutdownTracing(flushCtx); err != nil {
+		undone++
+		slog.Warn("flush traces", "error", err)
 	}
-	defer writer.Close()
 
-	pool := worker.NewPool(writer, worker.Options{
+	slog.Info("shutdown complete",
+		"elapsed", time.Since(started).Round(time.Millisecond),
+		"timed_out", ctx.Err() != nil,
+		"discarded", drained.Discarded,
+		"unfinished", drained.Unfinished,
+		"steps_undone", undone,
+	)
+}
+
+// reloadTuning re-reads the config file and environment and applies the pool
+// tuning parameters. Other settings only take effect after a restart.
+func reloadTuning(path string, pool *worker.Pool) (worker.Tuning, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return worker.Tuning{}, err
+	}
+	pool.Update(worker.Tuning{
 		WorkerCount: cfg.WorkerCount,
-		JobBuffer:   cfg.JobBuffer,
 		BatchSize:   cfg.BatchSize,
 		FlushEvery:  cfg.BatchFlushInterval,
 		MaxRetries:  cfg.MaxRetries,
-		OnError: func(err error) {
-			collector.IncErrors()
-			log.Printf("process batch failed: %v", err)
-		},
-		OnSuccess: collector.IncProcessed,
 	})
+	return pool.Tuning(), nil
+}
 
-	pool.Start(ctx)
-	defer pool.Stop()
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
 
-	runner, err := consumer.NewRunner(ctx, cfg, pool)
-	if err != nil {
-		log.Fatalf("init consumer: %v", err)
+// probes mounts /livez, which only shows the process is serving, and /readyz,
+// which requires Postgres, the brokers, an active consumer group session and
+// worker loops that are turning. Workers legitimately block on backpressure
+// while the database is slow, and restarting the pod then would only add
+// load, so a stalled worker takes it out of rotation instead.
+func probes(cfg config.Config, writer *storage.PostgresWriter, runner *consumer.Runner, pool *worker.Pool) metrics.Mount {
+	workers := health.Check{Name: "workers", Run: func(context.Context) error {
+		if stalled := pool.StalledWorkers(cfg.HealthStallThreshold); len(stalled) > 0 {
+			return fmt.Errorf("workers %v stalled for over %s", stalled, cfg.HealthStallThreshold)
+		}
+		return nil
+	}}
+	return func(mux *http.ServeMux) {
+		mux.Handle("/livez", health.Handler(cfg.HealthCheckTimeout))
+		mux.Handle("/readyz", health.Handler(cfg.HealthCheckTimeout,
+			health.Check{Name: "postgres", Run: writer.Ping},
+			health.Check{Name: "kafka_brokers", Run: runner.CheckBrokers},
+			health.Check{Name: "consumer_session", Run: func(ctx context.Context) error {
+				return runner.CheckSession(ctx, cfg.KafkaSessionTimeout)
+			}},
+			workers,
+		))
 	}
-	defer runner.Close()
+}
+
+// configCommand implements "worker config check", which validates the
+// effective configuration and prints it with secrets redacted.
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintln(os.Stderr, "usage: worker config check [-config path]")
+		return 2
+	}
+	flags := flag.NewFlagSet("config check", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML config file")
+	_ = flags.Parse(args[1:])
 
-	if err := runner.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
-		log.Printf("runner terminated: %v", err)
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	out, err := cfg.Redacted().YAML()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "render config: %v\n", err)
+		return 1
 	}
+	_, _ = os.Stdout.Write(out)
+	return 0
 }
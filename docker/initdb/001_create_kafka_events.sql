@@ -6,5 +6,6 @@ CREATE TABLE IF NOT EXISTS kafka_events (
     value bytea NOT NULL,
     headers jsonb,
     event_time timestamptz NOT NULL,
+    ingested_at timestamptz NOT NULL DEFAULT now(),
     PRIMARY KEY (topic, partition, message_offset)
 );
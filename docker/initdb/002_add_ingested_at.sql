@@ -0,0 +1,3 @@
+-- Insert time used by the generator's verification mode to measure end-to-end
+-- latency. Safe to run against tables created before the column existed.
+ALTER TABLE kafka_events ADD COLUMN IF NOT EXISTS ingested_at timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"demo/internal/chaos"
+	"demo/internal/consumer"
+	"demo/internal/metrics"
+	"demo/internal/worker"
+)
+
+// API exposes operational controls for a running worker.
+type API struct {
+	Token     string
+	Runner    *consumer.Runner
+	Pool      *worker.Pool
+	Collector *metrics.Collector
+	// Reload re-reads the config file and applies pool tuning. Optional.
+	Reload func() (worker.Tuning, error)
+	// Chaos is the fault-injecting processor, set only when CHAOS_ENABLED.
+	Chaos *chaos.Processor
+}
+
+// ChaosStatus reports the injected faults and what they have done so far.
+type ChaosStatus struct {
+	Faults chaos.Faults `json:"faults"`
+	Stats  chaos.Stats  `json:"stats"`
+}
+
+// PartitionStatus merges assignment, pause state and lag for one partition.
+type PartitionStatus struct {
+	Topic          string  `json:"topic"`
+	Partition      int32   `json:"partition"`
+	Paused         bool    `json:"paused"`
+	HighWatermark  int64   `json:"high_watermark"`
+	WrittenOffset  int64   `json:"written_offset"`
+	Lag            int64   `json:"lag"`
+	TimeLagSeconds float64 `json:"time_lag_seconds"`
+}
+
+// Mount registers the admin routes under /admin/. Every route requires an
+// "Authorization: Bearer <token>" header matching Token.
+func (a *API) Mount(mux *http.ServeMux) {
+	mux.Handle("/admin/partitions", a.auth(http.MethodGet, a.partitions))
+	mux.Handle("/admin/pause", a.auth(http.MethodPost, a.pause))
+	mux.Handle("/admin/resume", a.auth(http.MethodPost, a.resume))
+	mux.Handle("/admin/flush", a.auth(http.MethodPost, a.flush))
+	mux.Handle("/admin/pool", a.auth(http.MethodGet, a.poolStats))
+	mux.Handle("/admin/reload", a.auth(http.MethodPost, a.reload))
+	mux.Handle("/admin/chaos", a.auth(http.MethodGet, a.chaosStatus))
+	mux.Handle("/admin/chaos/set", a.auth(http.MethodPost, a.chaosSet))
+	mux.Handle("/admin/chaos/clear", a.auth(http.MethodPost, a.chaosClear))
+}
+
+func (a *API) auth(method string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (a *API) partitions(w http.ResponseWriter, _ *http.Request) {
+	lags := make(map[string]metrics.PartitionLag)
+	for _, lag := range a.Collector.PartitionLags(time.Now()) {
+		lags[partitionID(lag.Topic, lag.Partition)] = lag
+	}
+
+	assignments := a.Runner.Assignments()
+	out := make([]PartitionStatus, 0, len(assignments))
+	for _, asg := range assignments {
+		status := PartitionStatus{Topic: asg.Topic, Partition: asg.Partition, Paused: asg.Paused, WrittenOffset: -1}
+		if lag, ok := lags[partitionID(asg.Topic, asg.Partition)]; ok {
+			status.HighWatermark = lag.HighWater
+			status.WrittenOffset = lag.WrittenOffset
+			status.Lag = lag.Lag
+			status.TimeLagSeconds = lag.TimeLag.Seconds()
+		}
+		out = append(out, status)
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (a *API) pause(w http.ResponseWriter, r *http.Request) {
+	topic, partitions, err := parseTarget(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.Runner.Pause(topic, partitions)
+	writeJSON(w, http.StatusOK, a.Runner.Assignments())
+}
+
+func (a *API) resume(w http.ResponseWriter, r *http.Request) {
+	topic, partitions, err := parseTarget(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	a.Runner.Resume(topic, partitions)
+	writeJSON(w, http.StatusOK, a.Runner.Assignments())
+}
+
+func (a *API) flush(w http.ResponseWriter, _ *http.Request) {
+	a.Pool.Flush()
+	slog.Info("flush requested via admin api")
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "flush requested"})
+}
+
+func (a *API) poolStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, a.Pool.Stats())
+}
+
+func (a *API) reload(w http.ResponseWriter, _ *http.Request) {
+	if a.Reload == nil {
+		writeError(w, http.StatusNotImplemented, "reload not configured")
+		return
+	}
+	tuning, err := a.Reload()
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, tuning)
+}
+
+func (a *API) chaosStatus(w http.ResponseWriter, _ *http.Request) {
+	if a.Chaos == nil {
+		writeError(w, http.StatusNotImplemented, "chaos not enabled")
+		return
+	}
+	writeJSON(w, http.StatusOK, ChaosStatus{Faults: a.Chaos.Faults(), Stats: a.Chaos.Stats()})
+}
+
+// chaosSet overrides the faults named in the query, keeping the others.
+func (a *API) chaosSet(w http.ResponseWriter, r *http.Request) {
+	if a.Chaos == nil {
+		writeError(w, http.StatusNotImplemented, "chaos not enabled")
+		return
+	}
+	faults, err := parseFaults(r, a.Chaos.Faults())
+	if err == nil {
+		err = a.Chaos.Set(faults)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ChaosStatus{Faults: a.Chaos.Faults(), Stats: a.Chaos.Stats()})
+}
+
+func (a *API) chaosClear(w http.ResponseWriter, _ *http.Request) {
+	if a.Chaos == nil {
+		writeError(w, http.StatusNotImplemented, "chaos not enabled")
+		return
+	}
+	_ = a.Chaos.Set(chaos.Faults{})
+	writeJSON(w, http.StatusOK, ChaosStatus{Faults: a.Chaos.Faults(), Stats: a.Chaos.Stats()})
+}
+
+// parseFaults applies the error_rate, partial_rate, hang_rate, slow_rate,
+// sqlstate, latency, latency_jitter and slow_latency query parameters to
+// current.
+func parseFaults(r *http.Request, current chaos.Faults) (chaos.Faults, error) {
+	q := r.URL.Query()
+	rates := map[string]*float64{
+		"error_rate":   &current.ErrorRate,
+		"partial_rate": &current.PartialRate,
+		"hang_rate":    &current.HangRate,
+		"slow_rate":    &current.SlowRate,
+	}
+	for name, dst := range rates {
+		if raw := strings.TrimSpace(q.Get(name)); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return current, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*dst = v
+		}
+	}
+	durations := map[string]*time.Duration{
+		"latency":        &current.Latency,
+		"latency_jitter": &current.LatencyJitter,
+		"slow_latency":   &current.SlowLatency,
+	}
+	for name, dst := range durations {
+		if raw := strings.TrimSpace(q.Get(name)); raw != "" {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return current, fmt.Errorf("invalid %s %q", name, raw)
+			}
+			*dst = d
+		}
+	}
+	if q.Has("sqlstate") {
+		current.SQLState = strings.ToUpper(strings.TrimSpace(q.Get("sqlstate")))
+	}
+	return current, nil
+}
+
+// parseTarget reads the optional topic and comma-separated partitions query
+// parameters. Partitions without a topic are rejected.
+func parseTarget(r *http.Request) (string, []int32, error) {
+	topic := strings.TrimSpace(r.URL.Query().Get("topic"))
+	raw := strings.TrimSpace(r.URL.Query().Get("partitions"))
+	if raw == "" {
+		return topic, nil, nil
+	}
+	if topic == "" {
+		return "", nil, fmt.Errorf("partitions require a topic")
+	}
+	var partitions []int32
+	for _, item := range strings.Split(raw, ",") {
+		p, err := strconv.ParseInt(strings.TrimSpace(item), 10, 32)
+		if err != nil || p < 0 {
+			return "", nil, fmt.Errorf("invalid partition %q", item)
+		}
+		partitions = append(partitions, int32(p))
+	}
+	return topic, partitions, nil
+}
+
+func partitionID(topic string, partition int32) string {
+	return topic + "/" + strconv.Itoa(int(partition))
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
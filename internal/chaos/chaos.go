@@ -0,0 +1,241 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"demo/internal/worker"
+)
+
+// DefaultSQLState is reported by injected errors when Faults.SQLState is
+// empty: connection_failure, which the pool treats like any transient error.
+const DefaultSQLState = "08006"
+
+// Faults describes what to inject. Rates are per-batch probabilities in
+// [0,1]; the zero value injects nothing.
+type Faults struct {
+	// ErrorRate fails batches before anything reaches the database.
+	ErrorRate float64
+	// PartialRate writes a random leading part of the batch, then fails.
+	PartialRate float64
+	// HangRate blocks batches like a stuck query, until their context ends or
+	// the faults are next updated, which fails them.
+	HangRate float64
+	// SQLState is the code carried by injected *pgconn.PgError values.
+	SQLState string
+	// Latency plus a uniform [0, LatencyJitter) delay is added to every
+	// batch; SlowRate of batches wait SlowLatency on top, for a long tail.
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	SlowRate      float64
+	SlowLatency   time.Duration
+}
+
+// Validate reports the first out-of-range field.
+func (f Faults) Validate() error {
+	rates := []struct {
+		name string
+		rate float64
+	}{
+		{"error_rate", f.ErrorRate},
+		{"partial_rate", f.PartialRate},
+		{"hang_rate", f.HangRate},
+		{"slow_rate", f.SlowRate},
+	}
+	for _, r := range rates {
+		if r.rate < 0 || r.rate > 1 {
+			return fmt.Errorf("%s must be within [0,1], got %g", r.name, r.rate)
+		}
+	}
+	if f.Latency < 0 || f.LatencyJitter < 0 || f.SlowLatency < 0 {
+		return fmt.Errorf("latencies must be >= 0")
+	}
+	if f.SQLState != "" && len(f.SQLState) != 5 {
+		return fmt.Errorf("sqlstate must be 5 characters, got %q", f.SQLState)
+	}
+	return nil
+}
+
+// MarshalJSON renders durations as strings such as "250ms".
+func (f Faults) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ErrorRate     float64 `json:"error_rate"`
+		PartialRate   float64 `json:"partial_rate"`
+		HangRate      float64 `json:"hang_rate"`
+		SQLState      string  `json:"sqlstate"`
+		Latency       string  `json:"latency"`
+		LatencyJitter string  `json:"latency_jitter"`
+		SlowRate      float64 `json:"slow_rate"`
+		SlowLatency   string  `json:"slow_latency"`
+	}{
+		f.ErrorRate, f.PartialRate, f.HangRate, f.sqlState(),
+		f.Latency.String(), f.LatencyJitter.String(), f.SlowRate, f.SlowLatency.String(),
+	})
+}
+
+func (f Faults) sqlState() string {
+	if f.SQLState == "" {
+		return DefaultSQLState
+	}
+	return f.SQLState
+}
+
+// Stats counts injected faults since start.
+type Stats struct {
+	Batches  int64 `json:"batches"`
+	Errors   int64 `json:"errors"`
+	Partials int64 `json:"partials"`
+	Hangs    int64 `json:"hangs"`
+	Delayed  int64 `json:"delayed"`
+}
+
+// Processor wraps a worker.Processor and injects the configured faults in
+// front of it. Faults can be swapped while batches are in flight.
+type Processor struct {
+	next   worker.Processor
+	faults atomic.Pointer[Faults]
+
+	mu  sync.Mutex
+	rng *rand.Rand
+	// updated is closed and replaced by Set, releasing hung batches.
+	updated chan struct{}
+
+	batches, errors, partials, hangs, delayed atomic.Int64
+}
+
+// NewProcessor wraps next with the given faults.
+func NewProcessor(next worker.Processor, faults Faults) (*Processor, error) {
+	p := &Processor{next: next, rng: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	if err := p.Set(faults); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Faults returns the faults currently injected.
+func (p *Processor) Faults() Faults {
+	return *p.faults.Load()
+}
+
+// Set replaces the injected faults. Hung batches are released with an
+// error; delayed batches keep the delay they were started with.
+func (p *Processor) Set(faults Faults) error {
+	if err := faults.Validate(); err != nil {
+		return err
+	}
+	p.faults.Store(&faults)
+	p.mu.Lock()
+	if p.updated != nil {
+		close(p.updated)
+	}
+	p.updated = make(chan struct{})
+	p.mu.Unlock()
+	slog.Warn("chaos faults updated",
+		"error_rate", faults.ErrorRate,
+		"partial_rate", faults.PartialRate,
+		"hang_rate", faults.HangRate,
+		"sqlstate", faults.sqlState(),
+		"latency", faults.Latency,
+		"latency_jitter", faults.LatencyJitter,
+		"slow_rate", faults.SlowRate,
+		"slow_latency", faults.SlowLatency,
+	)
+	return nil
+}
+
+// Stats returns the injection counters.
+func (p *Processor) Stats() Stats {
+	return Stats{
+		Batches:  p.batches.Load(),
+		Errors:   p.errors.Load(),
+		Partials: p.partials.Load(),
+		Hangs:    p.hangs.Load(),
+		Delayed:  p.delayed.Load(),
+	}
+}
+
+// ProcessBatch delays, hangs or fails the batch according to the current
+// faults, otherwise delegates to the wrapped processor.
+func (p *Processor) ProcessBatch(ctx context.Context, records []worker.Record) error {
+	p.mu.Lock()
+	f, updated := p.Faults(), p.updated
+	p.mu.Unlock()
+	p.batches.Add(1)
+
+	if delay := p.delay(f); delay > 0 {
+		p.delayed.Add(1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+
+	switch {
+	case p.roll(f.HangRate):
+		p.hangs.Add(1)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("chaos: hung batch: %w", ctx.Err())
+		case <-updated:
+			return injected(f, "hung batch released by a fault update")
+		}
+	case p.roll(f.ErrorRate):
+		p.errors.Add(1)
+		return injected(f, "injected batch failure")
+	case len(records) > 1 && p.roll(f.PartialRate):
+		p.partials.Add(1)
+		n := 1 + p.intn(len(records)-1)
+		if err := p.next.ProcessBatch(ctx, records[:n]); err != nil {
+			return err
+		}
+		return injected(f, fmt.Sprintf("injected failure after %d of %d records", n, len(records)))
+	}
+	return p.next.ProcessBatch(ctx, records)
+}
+
+func (p *Processor) delay(f Faults) time.Duration {
+	d := f.Latency
+	if f.LatencyJitter > 0 {
+		d += time.Duration(p.int63n(int64(f.LatencyJitter)))
+	}
+	if p.roll(f.SlowRate) {
+		d += f.SlowLatency
+	}
+	return d
+}
+
+func (p *Processor) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rng.Float64() < rate
+}
+
+func (p *Processor) intn(n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rng.Intn(n)
+}
+
+func (p *Processor) int63n(n int64) int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rng.Int63n(n)
+}
+
+func injected(f Faults, msg string) error {
+	return &pgconn.PgError{Severity: "ERROR", Code: f.sqlState(), Message: "chaos: " + msg}
+}
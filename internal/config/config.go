@@ -1,90 +1,465 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/IBM/sarama"
+	"gopkg.in/yaml.v3"
+
+	"demo/internal/redact"
 )
 
-// Config captures runtime parameters for the worker pool POC.
+// Config captures runtime parameters for the worker pool POC. Every field can
+// be set in the YAML config file under its yaml key and overridden by the
+// environment variable of the same name in upper case.
 type Config struct {
-	KafkaBrokers        []string
-	KafkaTopic          string
-	KafkaGroup          string
-	KafkaVersion        string
-	KafkaSessionTimeout time.Duration
-	KafkaHeartbeat      time.Duration
-	KafkaMaxPollRecords int
+	KafkaBrokers        []string      `yaml:"kafka_brokers"`
+	KafkaTopic          string        `yaml:"kafka_topic"`
+	KafkaGroup          string        `yaml:"kafka_group"`
+	KafkaVersion        string        `yaml:"kafka_version"`
+	KafkaSessionTimeout time.Duration `yaml:"kafka_session_timeout"`
+	KafkaHeartbeat      time.Duration `yaml:"kafka_heartbeat"`
+	KafkaMaxPollRecords int           `yaml:"kafka_max_poll"`
+	KafkaIsolationLevel string        `yaml:"kafka_isolation_level"`
+
+	DBURL             string        `yaml:"database_url"`
+	DBTable           string        `yaml:"db_table"`
+	DBMaxConns        int32         `yaml:"db_max_conns"`
+	DBMaxConnLifetime time.Duration `yaml:"db_max_conn_lifetime"`
+	DBMaxConnIdleTime time.Duration `yaml:"db_max_conn_idle"`
+
+	// DBConcurrencyMax caps in-flight batch writes; 0 uses DBMaxConns and a
+	// negative value disables the adaptive limiter.
+	DBConcurrencyInitial int           `yaml:"db_concurrency_initial"`
+	DBConcurrencyMin     int           `yaml:"db_concurrency_min"`
+	DBConcurrencyMax     int           `yaml:"db_concurrency_max"`
+	DBLatencyThreshold   time.Duration `yaml:"db_latency_threshold"`
+
+	WorkerCount        int           `yaml:"worker_count"`
+	JobBuffer          int           `yaml:"job_buffer"`
+	MaxBufferedBytes   ByteSize      `yaml:"max_buffered_bytes"`
+	BatchFlushInterval time.Duration `yaml:"batch_flush_interval"`
+	BatchSize          int           `yaml:"batch_size"`
+	MaxRetries         int           `yaml:"max_retries"`
+	RetryCapacity      int           `yaml:"retry_capacity"`
+	RetryBaseDelay     time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay      time.Duration `yaml:"retry_max_delay"`
+	BatchTargetLatency time.Duration `yaml:"batch_target_latency"`
+	BatchSizeMin       int           `yaml:"batch_size_min"`
+	BatchSizeMax       int           `yaml:"batch_size_max"`
 
-	DBURL             string
-	DBTable           string
-	DBMaxConns        int32
-	DBMaxConnLifetime time.Duration
-	DBMaxConnIdleTime time.Duration
+	MetricsAddr string `yaml:"metrics_addr"`
+	AdminToken  string `yaml:"admin_token"`
 
-	WorkerCount        int
-	JobBuffer          int
-	BatchFlushInterval time.Duration
-	BatchSize          int
-	MaxRetries         int
+	HealthCheckTimeout   time.Duration `yaml:"health_check_timeout"`
+	HealthStallThreshold time.Duration `yaml:"health_stall_threshold"`
 
-	MetricsAddr string
+	ShutdownGracePeriod time.Duration `yaml:"shutdown_grace_period"`
+
+	ChaosEnabled       bool          `yaml:"chaos_enabled"`
+	ChaosErrorRate     float64       `yaml:"chaos_error_rate"`
+	ChaosPartialRate   float64       `yaml:"chaos_partial_rate"`
+	ChaosHangRate      float64       `yaml:"chaos_hang_rate"`
+	ChaosSQLState      string        `yaml:"chaos_sqlstate"`
+	ChaosLatency       time.Duration `yaml:"chaos_latency"`
+	ChaosLatencyJitter time.Duration `yaml:"chaos_latency_jitter"`
+	ChaosSlowRate      float64       `yaml:"chaos_slow_rate"`
+	ChaosSlowLatency   time.Duration `yaml:"chaos_slow_latency"`
+
+	TraceExporter    string `yaml:"otel_traces_exporter"`
+	TraceServiceName string `yaml:"otel_service_name"`
+
+	LogFormat       string        `yaml:"log_format"`
+	LogLevel        string        `yaml:"log_level"`
+	LogRepeatLimit  int           `yaml:"log_repeat_limit"`
+	LogRepeatWindow time.Duration `yaml:"log_repeat_window"`
+}
+
+// Consumer isolation levels for KAFKA_ISOLATION_LEVEL. read_committed skips
+// records of aborted transactions and waits for open ones to finish.
+const (
+	IsolationReadCommitted   = "read_committed"
+	IsolationReadUncommitted = "read_uncommitted"
+)
+
+// Defaults returns the configuration used when neither a file nor the
+// environment sets a value.
+func Defaults() Config {
+	return Config{
+		KafkaBrokers:         []string{"localhost:9092"},
+		KafkaTopic:           "staging.events",
+		KafkaGroup:           "event-writer",
+		KafkaVersion:         "3.6.1",
+		KafkaSessionTimeout:  30 * time.Second,
+		KafkaHeartbeat:       3 * time.Second,
+		KafkaMaxPollRecords:  500,
+		KafkaIsolationLevel:  IsolationReadCommitted,
+		DBTable:              "kafka_events",
+		DBMaxConns:           128,
+		DBMaxConnLifetime:    30 * time.Minute,
+		DBMaxConnIdleTime:    5 * time.Minute,
+		DBConcurrencyInitial: 16,
+		DBConcurrencyMin:     2,
+		DBLatencyThreshold:   250 * time.Millisecond,
+		WorkerCount:          80,
+		JobBuffer:            8192,
+		MaxBufferedBytes:     256 << 20,
+		BatchFlushInterval:   40 * time.Millisecond,
+		BatchSize:            256,
+		MaxRetries:           5,
+		RetryCapacity:        10000,
+		RetryBaseDelay:       100 * time.Millisecond,
+		RetryMaxDelay:        5 * time.Second,
+		BatchSizeMin:         16,
+		BatchSizeMax:         4096,
+		MetricsAddr:          ":2112",
+		HealthCheckTimeout:   2 * time.Second,
+		HealthStallThreshold: time.Minute,
+		ShutdownGracePeriod:  25 * time.Second,
+		TraceExporter:        "none",
+		TraceServiceName:     "kafka-to-db-worker",
+		LogFormat:            "json",
+		LogLevel:             "info",
+		LogRepeatLimit:       5,
+		LogRepeatWindow:      10 * time.Second,
+	}
 }
 
 // FromEnv constructs Config using environment variables with sensible defaults.
 func FromEnv() (Config, error) {
-	cfg := Config{
-		KafkaVersion:        getenv("KAFKA_VERSION", "3.6.1"),
-		KafkaSessionTimeout: mustParseDuration(getenv("KAFKA_SESSION_TIMEOUT", "30s")),
-		KafkaHeartbeat:      mustParseDuration(getenv("KAFKA_HEARTBEAT", "3s")),
-		KafkaMaxPollRecords: mustParseInt(getenv("KAFKA_MAX_POLL", "500")),
-		DBTable:             getenv("DB_TABLE", "kafka_events"),
-		DBMaxConns:          int32(mustParseInt(getenv("DB_MAX_CONNS", "128"))),
-		DBMaxConnLifetime:   mustParseDuration(getenv("DB_MAX_CONN_LIFETIME", "30m")),
-		DBMaxConnIdleTime:   mustParseDuration(getenv("DB_MAX_CONN_IDLE", "5m")),
-		WorkerCount:         mustParseInt(getenv("WORKER_COUNT", "80")),
-		JobBuffer:           mustParseInt(getenv("JOB_BUFFER", "8192")),
-		BatchFlushInterval:  mustParseDuration(getenv("BATCH_FLUSH_INTERVAL", "40ms")),
-		BatchSize:           mustParseInt(getenv("BATCH_SIZE", "256")),
-		MaxRetries:          mustParseInt(getenv("MAX_RETRIES", "5")),
-		MetricsAddr:         getenv("METRICS_ADDR", ":2112"),
-	}
-
-	brokers := strings.Split(getenv("KAFKA_BROKERS", "localhost:9092"), ",")
-	if len(brokers) == 1 && brokers[0] == "" {
-		return Config{}, fmt.Errorf("KAFKA_BROKERS must be provided")
-	}
-	cfg.KafkaBrokers = brokers
-	cfg.KafkaTopic = getenv("KAFKA_TOPIC", "staging.events")
-	cfg.KafkaGroup = getenv("KAFKA_GROUP", "event-writer")
-	cfg.DBURL = strings.TrimSpace(os.Getenv("DATABASE_URL"))
-	if cfg.DBURL == "" {
-		return Config{}, fmt.Errorf("DATABASE_URL must be provided")
+	return Load("")
+}
+
+// Load builds the effective configuration: defaults, then the YAML file at
+// path (if any) with ${VAR} references expanded, then environment overrides.
+// Every invalid value is reported together in a *ValidationError.
+func Load(path string) (Config, error) {
+	cfg := Defaults()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var problems []string
+	for _, b := range bindings(&cfg) {
+		v, ok := os.LookupEnv(b.env)
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		if err := b.set(strings.TrimSpace(v)); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", b.env, err))
+		}
+	}
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return Config{}, &ValidationError{Problems: problems}
 	}
 	return cfg, nil
 }
 
-func getenv(key, fallback string) string {
-	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
-		return v
+func (c *Config) loadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
 	}
-	return fallback
+	dec := yaml.NewDecoder(strings.NewReader(Interpolate(string(raw))))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
 }
 
-func mustParseDuration(v string) time.Duration {
-	d, err := time.ParseDuration(v)
-	if err != nil {
-		panic(fmt.Sprintf("invalid duration %q: %v", v, err))
+// Interpolate expands ${VAR} and ${VAR:-default} references using the
+// process environment. Bare $ characters are left untouched so DSNs and
+// passwords survive as written.
+func Interpolate(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := strings.Index(s[start:], "}")
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:start])
+		expr := s[start+2 : start+end]
+		name, fallback, hasFallback := strings.Cut(expr, ":-")
+		if v, ok := os.LookupEnv(name); ok && (v != "" || !hasFallback) {
+			b.WriteString(v)
+		} else {
+			b.WriteString(fallback)
+		}
+		s = s[start+end+1:]
 	}
-	return d
 }
 
-func mustParseInt(v string) int {
-	iv, err := strconv.Atoi(v)
-	if err != nil {
-		panic(fmt.Sprintf("invalid int %q: %v", v, err))
+// ValidationError lists every problem found while loading configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(len(c.KafkaBrokers) > 0, "KAFKA_BROKERS must be provided")
+	for _, broker := range c.KafkaBrokers {
+		check(strings.TrimSpace(broker) != "", "KAFKA_BROKERS must not contain empty entries")
+	}
+	check(c.KafkaTopic != "", "KAFKA_TOPIC must be provided")
+	check(c.KafkaGroup != "", "KAFKA_GROUP must be provided")
+	if _, err := sarama.ParseKafkaVersion(c.KafkaVersion); err != nil {
+		problems = append(problems, fmt.Sprintf("KAFKA_VERSION %q is not a valid kafka version", c.KafkaVersion))
+	}
+	check(c.KafkaSessionTimeout > 0, "KAFKA_SESSION_TIMEOUT must be > 0")
+	check(c.KafkaHeartbeat > 0, "KAFKA_HEARTBEAT must be > 0")
+	check(c.KafkaHeartbeat < c.KafkaSessionTimeout, "KAFKA_HEARTBEAT (%s) must be shorter than KAFKA_SESSION_TIMEOUT (%s)", c.KafkaHeartbeat, c.KafkaSessionTimeout)
+	check(c.KafkaMaxPollRecords > 0, "KAFKA_MAX_POLL must be > 0")
+	check(c.KafkaIsolationLevel == IsolationReadCommitted || c.KafkaIsolationLevel == IsolationReadUncommitted,
+		"KAFKA_ISOLATION_LEVEL must be %s or %s", IsolationReadCommitted, IsolationReadUncommitted)
+	if version, err := sarama.ParseKafkaVersion(c.KafkaVersion); err == nil {
+		check(c.KafkaIsolationLevel != IsolationReadCommitted || version.IsAtLeast(sarama.V0_11_0_0),
+			"KAFKA_ISOLATION_LEVEL=%s requires KAFKA_VERSION >= 0.11.0", IsolationReadCommitted)
+	}
+
+	check(c.DBURL != "", "DATABASE_URL must be provided")
+	check(c.DBTable != "", "DB_TABLE must be provided")
+	check(c.DBMaxConns > 0, "DB_MAX_CONNS must be > 0")
+	check(c.DBMaxConnLifetime >= 0, "DB_MAX_CONN_LIFETIME must be >= 0")
+	check(c.DBMaxConnIdleTime >= 0, "DB_MAX_CONN_IDLE must be >= 0")
+	if c.DBConcurrencyMax >= 0 {
+		check(c.DBConcurrencyMin > 0, "DB_CONCURRENCY_MIN must be > 0")
+		check(c.DBConcurrencyInitial >= c.DBConcurrencyMin, "DB_CONCURRENCY_INITIAL (%d) must be >= DB_CONCURRENCY_MIN (%d)", c.DBConcurrencyInitial, c.DBConcurrencyMin)
+		check(c.DBConcurrencyMax == 0 || c.DBConcurrencyMax >= c.DBConcurrencyInitial, "DB_CONCURRENCY_MAX (%d) must be >= DB_CONCURRENCY_INITIAL (%d)", c.DBConcurrencyMax, c.DBConcurrencyInitial)
+		check(c.DBLatencyThreshold >= 0, "DB_LATENCY_THRESHOLD must be >= 0")
+	}
+
+	check(c.WorkerCount > 0, "WORKER_COUNT must be > 0")
+	check(c.JobBuffer > 0, "JOB_BUFFER must be > 0")
+	check(c.MaxBufferedBytes >= 0, "MAX_BUFFERED_BYTES must be >= 0")
+	check(c.BatchFlushInterval > 0, "BATCH_FLUSH_INTERVAL must be > 0")
+	check(c.BatchSize > 0, "BATCH_SIZE must be > 0")
+	check(c.MaxRetries > 0, "MAX_RETRIES must be > 0")
+	check(c.RetryCapacity > 0, "RETRY_CAPACITY must be > 0")
+	check(c.RetryBaseDelay > 0, "RETRY_BASE_DELAY must be > 0")
+	check(c.RetryMaxDelay >= c.RetryBaseDelay, "RETRY_MAX_DELAY (%s) must be >= RETRY_BASE_DELAY (%s)", c.RetryMaxDelay, c.RetryBaseDelay)
+	check(c.BatchTargetLatency >= 0, "BATCH_TARGET_LATENCY must be >= 0")
+	if c.BatchTargetLatency > 0 {
+		check(c.BatchSizeMin > 0, "BATCH_SIZE_MIN must be > 0")
+		check(c.BatchSizeMax >= c.BatchSizeMin, "BATCH_SIZE_MAX (%d) must be >= BATCH_SIZE_MIN (%d)", c.BatchSizeMax, c.BatchSizeMin)
+	}
+
+	check(c.MetricsAddr != "", "METRICS_ADDR must be provided")
+	check(c.HealthCheckTimeout > 0, "HEALTH_CHECK_TIMEOUT must be > 0")
+	check(c.HealthStallThreshold > 0, "HEALTH_STALL_THRESHOLD must be > 0")
+	check(c.ShutdownGracePeriod > 0, "SHUTDOWN_GRACE_PERIOD must be > 0")
+
+	for _, rate := range []struct {
+		env string
+		v   float64
+	}{
+		{"CHAOS_ERROR_RATE", c.ChaosErrorRate},
+		{"CHAOS_PARTIAL_RATE", c.ChaosPartialRate},
+		{"CHAOS_HANG_RATE", c.ChaosHangRate},
+		{"CHAOS_SLOW_RATE", c.ChaosSlowRate},
+	} {
+		check(rate.v >= 0 && rate.v <= 1, "%s must be within [0,1]", rate.env)
+	}
+	check(c.ChaosSQLState == "" || len(c.ChaosSQLState) == 5, "CHAOS_SQLSTATE %q must be a 5 character SQLSTATE", c.ChaosSQLState)
+	check(c.ChaosLatency >= 0, "CHAOS_LATENCY must be >= 0")
+	check(c.ChaosLatencyJitter >= 0, "CHAOS_LATENCY_JITTER must be >= 0")
+	check(c.ChaosSlowLatency >= 0, "CHAOS_SLOW_LATENCY must be >= 0")
+
+	switch c.TraceExporter {
+	case "none", "stdout", "otlpgrpc", "otlphttp":
+	default:
+		problems = append(problems, fmt.Sprintf("OTEL_TRACES_EXPORTER %q must be one of none, stdout, otlpgrpc, otlphttp", c.TraceExporter))
+	}
+	check(c.TraceServiceName != "", "OTEL_SERVICE_NAME must be provided")
+
+	check(c.LogFormat == "json" || c.LogFormat == "text", "LOG_FORMAT %q must be json or text", c.LogFormat)
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("LOG_LEVEL %q must be one of debug, info, warn, error", c.LogLevel))
+	}
+	check(c.LogRepeatLimit >= 0, "LOG_REPEAT_LIMIT must be >= 0")
+	check(c.LogRepeatWindow > 0, "LOG_REPEAT_WINDOW must be > 0")
+	return problems
+}
+
+// Redacted returns a copy safe to print: the database password and admin
+// token are masked.
+func (c Config) Redacted() Config {
+	out := c
+	out.KafkaBrokers = append([]string(nil), c.KafkaBrokers...)
+	out.DBURL = redact.DSN(c.DBURL)
+	if c.AdminToken != "" {
+		out.AdminToken = redact.Value
+	}
+	return out
+}
+
+// YAML renders the configuration in the config file format.
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type binding struct {
+	env string
+	set func(string) error
+}
+
+func bindings(c *Config) []binding {
+	return []binding{
+		{"KAFKA_BROKERS", list(&c.KafkaBrokers)},
+		{"KAFKA_TOPIC", str(&c.KafkaTopic)},
+		{"KAFKA_GROUP", str(&c.KafkaGroup)},
+		{"KAFKA_VERSION", str(&c.KafkaVersion)},
+		{"KAFKA_SESSION_TIMEOUT", duration(&c.KafkaSessionTimeout)},
+		{"KAFKA_HEARTBEAT", duration(&c.KafkaHeartbeat)},
+		{"KAFKA_MAX_POLL", integer(&c.KafkaMaxPollRecords)},
+		{"KAFKA_ISOLATION_LEVEL", str(&c.KafkaIsolationLevel)},
+		{"DATABASE_URL", str(&c.DBURL)},
+		{"DB_TABLE", str(&c.DBTable)},
+		{"DB_MAX_CONNS", int32Value(&c.DBMaxConns)},
+		{"DB_MAX_CONN_LIFETIME", duration(&c.DBMaxConnLifetime)},
+		{"DB_MAX_CONN_IDLE", duration(&c.DBMaxConnIdleTime)},
+		{"DB_CONCURRENCY_INITIAL", integer(&c.DBConcurrencyInitial)},
+		{"DB_CONCURRENCY_MIN", integer(&c.DBConcurrencyMin)},
+		{"DB_CONCURRENCY_MAX", integer(&c.DBConcurrencyMax)},
+		{"DB_LATENCY_THRESHOLD", duration(&c.DBLatencyThreshold)},
+		{"WORKER_COUNT", integer(&c.WorkerCount)},
+		{"JOB_BUFFER", integer(&c.JobBuffer)},
+		{"MAX_BUFFERED_BYTES", byteSize(&c.MaxBufferedBytes)},
+		{"BATCH_FLUSH_INTERVAL", duration(&c.BatchFlushInterval)},
+		{"BATCH_SIZE", integer(&c.BatchSize)},
+		{"MAX_RETRIES", integer(&c.MaxRetries)},
+		{"RETRY_CAPACITY", integer(&c.RetryCapacity)},
+		{"RETRY_BASE_DELAY", duration(&c.RetryBaseDelay)},
+		{"RETRY_MAX_DELAY", duration(&c.RetryMaxDelay)},
+		{"BATCH_TARGET_LATENCY", duration(&c.BatchTargetLatency)},
+		{"BATCH_SIZE_MIN", integer(&c.BatchSizeMin)},
+		{"BATCH_SIZE_MAX", integer(&c.BatchSizeMax)},
+		{"METRICS_ADDR", str(&c.MetricsAddr)},
+		{"ADMIN_TOKEN", str(&c.AdminToken)},
+		{"HEALTH_CHECK_TIMEOUT", duration(&c.HealthCheckTimeout)},
+		{"HEALTH_STALL_THRESHOLD", duration(&c.HealthStallThreshold)},
+		{"SHUTDOWN_GRACE_PERIOD", duration(&c.ShutdownGracePeriod)},
+		{"CHAOS_ENABLED", boolean(&c.ChaosEnabled)},
+		{"CHAOS_ERROR_RATE", float(&c.ChaosErrorRate)},
+		{"CHAOS_PARTIAL_RATE", float(&c.ChaosPartialRate)},
+		{"CHAOS_HANG_RATE", float(&c.ChaosHangRate)},
+		{"CHAOS_SQLSTATE", str(&c.ChaosSQLState)},
+		{"CHAOS_LATENCY", duration(&c.ChaosLatency)},
+		{"CHAOS_LATENCY_JITTER", duration(&c.ChaosLatencyJitter)},
+		{"CHAOS_SLOW_RATE", float(&c.ChaosSlowRate)},
+		{"CHAOS_SLOW_LATENCY", duration(&c.ChaosSlowLatency)},
+		{"OTEL_TRACES_EXPORTER", lower(&c.TraceExporter)},
+		{"OTEL_SERVICE_NAME", str(&c.TraceServiceName)},
+		{"LOG_FORMAT", lower(&c.LogFormat)},
+		{"LOG_LEVEL", lower(&c.LogLevel)},
+		{"LOG_REPEAT_LIMIT", integer(&c.LogRepeatLimit)},
+		{"LOG_REPEAT_WINDOW", duration(&c.LogRepeatWindow)},
+	}
+}
+
+func str(dst *string) func(string) error {
+	return func(v string) error {
+		*dst = v
+		return nil
+	}
+}
+
+func lower(dst *string) func(string) error {
+	return func(v string) error {
+		*dst = strings.ToLower(v)
+		return nil
+	}
+}
+
+func list(dst *[]string) func(string) error {
+	return func(v string) error {
+		var items []string
+		for _, item := range strings.Split(v, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+		*dst = items
+		return nil
+	}
+}
+
+func duration(dst *time.Duration) func(string) error {
+	return func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", v)
+		}
+		*dst = d
+		return nil
+	}
+}
+
+func integer(dst *int) func(string) error {
+	return func(v string) error {
+		iv, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid int %q", v)
+		}
+		*dst = iv
+		return nil
+	}
+}
+
+func float(dst *float64) func(string) error {
+	return func(v string) error {
+		fv, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*dst = fv
+		return nil
+	}
+}
+
+func boolean(dst *bool) func(string) error {
+	return func(v string) error {
+		bv, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid bool %q", v)
+		}
+		*dst = bv
+		return nil
+	}
+}
+
+func int32Value(dst *int32) func(string) error {
+	return func(v string) error {
+		iv, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid int %q", v)
+		}
+		*dst = int32(iv)
+		return nil
 	}
-	return iv
 }
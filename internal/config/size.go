@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a byte count written either as a plain integer or with a
+// KB/MB/GB (powers of 1000) or KiB/MiB/GiB (powers of 1024) suffix.
+type ByteSize int64
+
+var byteUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1e3}, {"mb", 1e6}, {"gb", 1e9},
+	{"b", 1},
+}
+
+// ParseByteSize parses values such as "512MiB", "2GB" or "1048576".
+func ParseByteSize(v string) (ByteSize, error) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	scale := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, scale = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", v)
+	}
+	if n > math.MaxInt64/scale || n < math.MinInt64/scale {
+		return 0, fmt.Errorf("byte size %q overflows int64", v)
+	}
+	return ByteSize(n * scale), nil
+}
+
+// String renders the size with the largest binary unit that divides it.
+func (b ByteSize) String() string {
+	for _, unit := range []struct {
+		suffix string
+		scale  int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if b != 0 && int64(b)%unit.scale == 0 {
+			return strconv.FormatInt(int64(b)/unit.scale, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// UnmarshalYAML accepts both integers and suffixed strings.
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := ParseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+	return nil
+}
+
+// MarshalYAML renders the size in its suffixed form.
+func (b ByteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
+
+func byteSize(dst *ByteSize) func(string) error {
+	return func(v string) error {
+		parsed, err := ParseByteSize(v)
+		if err != nil {
+			return err
+		}
+		*dst = parsed
+		return nil
+	}
+}
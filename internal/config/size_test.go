@@ -0,0 +1,61 @@
+package config
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{in: "1048576", want: 1 << 20},
+		{in: "512MiB", want: 512 << 20},
+		{in: "2GB", want: 2e9},
+		{in: " 4 kib ", want: 4 << 10},
+		{in: "10b", want: 10},
+		{in: "0", want: 0},
+		{in: "9223372036854775807", want: 1<<63 - 1},
+		{in: "8589934591GiB", want: 8589934591 << 30},
+		{in: "8589934592GiB", wantErr: true},
+		{in: "9300000000GB", wantErr: true},
+		{in: "-8589934593GiB", wantErr: true},
+		{in: "9223372036854775808", wantErr: true},
+		{in: "1.5GB", wantErr: true},
+		{in: "12XB", wantErr: true},
+		{in: "", wantErr: true},
+	} {
+		got, err := ParseByteSize(tc.in)
+		switch {
+		case tc.wantErr && err == nil:
+			t.Errorf("ParseByteSize(%q): want error, have %d", tc.in, got)
+		case !tc.wantErr && err != nil:
+			t.Errorf("ParseByteSize(%q): %v", tc.in, err)
+		case !tc.wantErr && got != tc.want:
+			t.Errorf("ParseByteSize(%q): want %d, have %d", tc.in, tc.want, got)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	for _, tc := range []struct {
+		in   ByteSize
+		want string
+	}{
+		{0, "0"},
+		{1000, "1000"},
+		{4 << 10, "4KiB"},
+		{3 << 20, "3MiB"},
+		{2 << 30, "2GiB"},
+		{(1 << 30) + (1 << 10), "1048577KiB"},
+	} {
+		if got := tc.in.String(); got != tc.want {
+			t.Errorf("ByteSize(%d).String(): want %q, have %q", int64(tc.in), tc.want, got)
+		}
+		if tc.in == 0 {
+			continue
+		}
+		if back, err := ParseByteSize(tc.in.String()); err != nil || back != tc.in {
+			t.Errorf("round trip of %d: have %d, %v", int64(tc.in), back, err)
+		}
+	}
+}
@@ -3,23 +3,50 @@ package consumer
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/IBM/sarama"
 
 	"demo/internal/config"
+	"demo/internal/metrics"
 	"demo/internal/worker"
 )
 
+const highWaterSampleInterval = time.Second
+
 // Runner wires a Kafka consumer group to a worker pool.
 type Runner struct {
-	cfg    config.Config
-	pool   *worker.Pool
-	client sarama.ConsumerGroup
+	cfg       config.Config
+	pool      *worker.Pool
+	collector *metrics.Collector
+	kafka     sarama.Client
+	client    sarama.ConsumerGroup
+	pauses    *pauseState
+	session   sessionState
+	stopping  atomic.Bool
+}
+
+// sessionState tracks whether a consumer group session is currently active
+// and since when it has been in its present state.
+type sessionState struct {
+	mu      sync.Mutex
+	active  bool
+	claims  int
+	changed time.Time
+	current sarama.ConsumerGroupSession
+}
+
+func (s *sessionState) set(current sarama.ConsumerGroupSession, claims int) {
+	s.mu.Lock()
+	s.active, s.claims, s.changed, s.current = current != nil, claims, time.Now(), current
+	s.mu.Unlock()
 }
 
 // NewRunner creates a consumer runner instance.
-func NewRunner(ctx context.Context, cfg config.Config, pool *worker.Pool) (*Runner, error) {
+func NewRunner(ctx context.Context, cfg config.Config, pool *worker.Pool, collector *metrics.Collector) (*Runner, error) {
 	saramaCfg := sarama.NewConfig()
 	version, err := sarama.ParseKafkaVersion(cfg.KafkaVersion)
 	if err != nil {
@@ -28,21 +55,31 @@ func NewRunner(ctx context.Context, cfg config.Config, pool *worker.Pool) (*Runn
 	saramaCfg.Version = version
 	saramaCfg.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRange
 	saramaCfg.Consumer.Return.Errors = true
+	saramaCfg.Consumer.IsolationLevel = sarama.ReadCommitted
+	if cfg.KafkaIsolationLevel == config.IsolationReadUncommitted {
+		saramaCfg.Consumer.IsolationLevel = sarama.ReadUncommitted
+	}
 	saramaCfg.Consumer.Offsets.AutoCommit.Enable = true
 	saramaCfg.Consumer.Offsets.AutoCommit.Interval = cfg.KafkaHeartbeat
 	saramaCfg.Consumer.Group.Session.Timeout = cfg.KafkaSessionTimeout
 	saramaCfg.Consumer.Group.Heartbeat.Interval = cfg.KafkaHeartbeat
 	saramaCfg.Metadata.RefreshFrequency = cfg.KafkaHeartbeat
 
-	client, err := sarama.NewConsumerGroup(cfg.KafkaBrokers, cfg.KafkaGroup, saramaCfg)
+	kafka, err := sarama.NewClient(cfg.KafkaBrokers, saramaCfg)
 	if err != nil {
+		return nil, fmt.Errorf("create kafka client: %w", err)
+	}
+	client, err := sarama.NewConsumerGroupFromClient(cfg.KafkaGroup, kafka)
+	if err != nil {
+		_ = kafka.Close()
 		return nil, fmt.Errorf("create consumer group: %w", err)
 	}
 
-	r := &Runner{cfg: cfg, pool: pool, client: client}
+	r := &Runner{cfg: cfg, pool: pool, collector: collector, kafka: kafka, client: client, pauses: newPauseState()}
+	r.session.set(nil, 0)
 	go func() {
 		for err := range client.Errors() {
-			log.Printf("consumer error: %v", err)
+			slog.Error("consumer error", "group", cfg.KafkaGroup, "error", err)
 		}
 	}()
 
@@ -51,7 +88,87 @@ func NewRunner(ctx context.Context, cfg config.Config, pool *worker.Pool) (*Runn
 
 // Close releases client resources.
 func (r *Runner) Close() error {
-	return r.client.Close()
+	if err := r.client.Close(); err != nil {
+		_ = r.kafka.Close()
+		return err
+	}
+	return r.kafka.Close()
+}
+
+// CheckBrokers refreshes metadata for the consumed topic, failing when no
+// broker can serve it.
+func (r *Runner) CheckBrokers(context.Context) error {
+	if err := r.kafka.RefreshMetadata(r.cfg.KafkaTopic); err != nil {
+		return fmt.Errorf("refresh metadata: %w", err)
+	}
+	partitions, err := r.kafka.Partitions(r.cfg.KafkaTopic)
+	if err != nil {
+		return fmt.Errorf("list partitions: %w", err)
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("topic %s has no partitions", r.cfg.KafkaTopic)
+	}
+	return nil
+}
+
+// CheckSession fails when the member has had no active session with at least
+// one assigned partition for longer than grace, which tolerates ordinary
+// rebalances.
+func (r *Runner) CheckSession(_ context.Context, grace time.Duration) error {
+	r.session.mu.Lock()
+	active, claims, since := r.session.active, r.session.claims, time.Since(r.session.changed)
+	r.session.mu.Unlock()
+
+	switch {
+	case active && claims > 0:
+		return nil
+	case since < grace:
+		return nil
+	case !active:
+		return fmt.Errorf("no active consumer group session for %s", since.Round(time.Second))
+	default:
+		return fmt.Errorf("no partitions assigned for %s", since.Round(time.Second))
+	}
+}
+
+// Assignments lists the partitions currently claimed by this member.
+func (r *Runner) Assignments() []PartitionAssignment {
+	return r.pauses.snapshot()
+}
+
+// Pause stops fetching from the given partitions until Resume is called. An
+// empty topic pauses every partition, including ones assigned after a
+// rebalance; no partitions means every assigned partition of the topic.
+func (r *Runner) Pause(topic string, partitions []int32) {
+	r.client.Pause(r.pauses.pause(topic, partitions))
+	slog.Info("consumption paused", "topic", topic, "partitions", partitions)
+}
+
+// Resume restarts fetching for partitions paused via Pause.
+func (r *Runner) Resume(topic string, partitions []int32) {
+	r.client.Resume(r.pauses.resume(topic, partitions))
+	slog.Info("consumption resumed", "topic", topic, "partitions", partitions)
+}
+
+// StopFetching pauses every partition and stops handing buffered messages to
+// the pool, so a drain only has to finish work already submitted. The
+// session stays open so marked offsets can still be committed.
+func (r *Runner) StopFetching() {
+	r.stopping.Store(true)
+	r.client.PauseAll()
+}
+
+// Commit synchronously commits the offsets marked so far in the current
+// session. It is a no-op without an active session.
+func (r *Runner) Commit() bool {
+	r.session.mu.Lock()
+	current := r.session.current
+	r.session.mu.Unlock()
+	if current == nil {
+		return false
+	}
+	current.Commit()
+	return true
 }
 
 // Run starts consuming the configured topic until the context is cancelled.
@@ -60,27 +177,90 @@ func (r *Runner) Run(ctx context.Context) error {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
-		handler := &groupHandler{pool: r.pool}
+		handler := &groupHandler{pool: r.pool, collector: r.collector, client: r.client, pauses: r.pauses, session: &r.session, stopping: &r.stopping}
 		if err := r.client.Consume(ctx, []string{r.cfg.KafkaTopic}, handler); err != nil {
-			log.Printf("consume error: %v", err)
+			slog.Error("consume error", "topic", r.cfg.KafkaTopic, "error", err)
 			// allow loop to retry on transient errors.
 		}
 	}
 }
 
 type groupHandler struct {
-	pool *worker.Pool
+	pool      *worker.Pool
+	collector *metrics.Collector
+	client    sarama.ConsumerGroup
+	pauses    *pauseState
+	session   *sessionState
+	stopping  *atomic.Bool
 }
 
-func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error   { return nil }
-func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	claims := session.Claims()
+	h.pauses.setAssigned(claims)
+	assigned := 0
+	for _, partitions := range claims {
+		assigned += len(partitions)
+	}
+	h.session.set(session, assigned)
+	return nil
+}
+
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	h.pauses.setAssigned(nil)
+	h.session.set(nil, 0)
+	return nil
+}
 
 func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	if h.pauses.isPaused(claim.Topic(), claim.Partition()) {
+		h.client.Pause(map[string][]int32{claim.Topic(): {claim.Partition()}})
+	}
+	h.collector.TrackPartition(claim.Topic(), claim.Partition(), claim.InitialOffset())
+	defer h.collector.ForgetPartition(claim.Topic(), claim.Partition())
+	defer func() {
+		if dropped := h.pool.Revoke(claim.Topic(), claim.Partition()); dropped > 0 {
+			slog.Info("discarded pending retries for revoked partition", "topic", claim.Topic(), "partition", claim.Partition(), "jobs", dropped)
+		}
+	}()
+
+	// Sample the high watermark independently of message delivery so lag keeps
+	// growing while Submit is blocked on a saturated pool.
+	done := make(chan struct{})
+	defer close(done)
+	go h.sampleHighWater(claim, done)
+
+	// next is the offset expected after the last message, -1 until known. A
+	// jump past it is an offset gap: aborted records under read_committed,
+	// transaction markers or compaction.
+	next := claim.InitialOffset()
 	for msg := range claim.Messages() {
+		if next >= 0 && msg.Offset > next {
+			h.collector.ObserveOffsetGap(msg.Offset - next)
+		}
+		next = msg.Offset + 1
+		if h.stopping.Load() {
+			// Shutting down: leave the rest of the fetched batch uncommitted.
+			continue
+		}
+		// Track the offset before the pool can finish it.
+		h.collector.ObserveReceived(msg.Topic, msg.Partition, msg.Offset, msg.Timestamp)
 		job := worker.Job{Message: msg, Session: session}
-		if ok := h.pool.Submit(job); !ok {
-			log.Printf("worker pool rejected message offset=%d", msg.Offset)
+		if ok := h.pool.Submit(job); !ok && !h.stopping.Load() {
+			slog.Warn("worker pool rejected message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
 		}
 	}
 	return nil
 }
+
+func (h *groupHandler) sampleHighWater(claim sarama.ConsumerGroupClaim, done <-chan struct{}) {
+	ticker := time.NewTicker(highWaterSampleInterval)
+	defer ticker.Stop()
+	for {
+		h.collector.ObserveHighWater(claim.Topic(), claim.Partition(), claim.HighWaterMarkOffset())
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package consumer
+
+import (
+	"sort"
+	"sync"
+)
+
+// pauseState remembers which partitions an operator asked to pause so the
+// request survives rebalances: sarama only pauses partition consumers that
+// exist at the time of the call.
+type pauseState struct {
+	mu         sync.Mutex
+	all        bool
+	partitions map[string]map[int32]bool
+	assigned   map[string][]int32
+}
+
+func newPauseState() *pauseState {
+	return &pauseState{
+		partitions: make(map[string]map[int32]bool),
+		assigned:   make(map[string][]int32),
+	}
+}
+
+func (s *pauseState) setAssigned(claims map[string][]int32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assigned = make(map[string][]int32, len(claims))
+	for topic, partitions := range claims {
+		s.assigned[topic] = append([]int32(nil), partitions...)
+	}
+}
+
+func (s *pauseState) isPaused(topic string, partition int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.all || s.partitions[topic][partition]
+}
+
+// pause records the request and returns the currently assigned partitions it
+// affects. An empty topic pauses everything, including future assignments.
+func (s *pauseState) pause(topic string, partitions []int32) map[string][]int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if topic == "" {
+		s.all = true
+		return s.copyAssigned()
+	}
+	targets := s.resolve(topic, partitions)
+	if s.partitions[topic] == nil {
+		s.partitions[topic] = make(map[int32]bool)
+	}
+	for _, p := range targets[topic] {
+		s.partitions[topic][p] = true
+	}
+	return targets
+}
+
+// resume clears a pause request and returns the assigned partitions to resume.
+func (s *pauseState) resume(topic string, partitions []int32) map[string][]int32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if topic == "" {
+		s.all = false
+		s.partitions = make(map[string]map[int32]bool)
+		return s.copyAssigned()
+	}
+	if s.all {
+		// Narrowing a global pause: keep everything else explicitly paused.
+		s.all = false
+		for t, ps := range s.assigned {
+			if s.partitions[t] == nil {
+				s.partitions[t] = make(map[int32]bool)
+			}
+			for _, p := range ps {
+				s.partitions[t][p] = true
+			}
+		}
+	}
+	targets := s.resolve(topic, partitions)
+	for _, p := range targets[topic] {
+		delete(s.partitions[topic], p)
+	}
+	if len(partitions) == 0 {
+		delete(s.partitions, topic)
+	}
+	return targets
+}
+
+func (s *pauseState) resolve(topic string, partitions []int32) map[string][]int32 {
+	if len(partitions) == 0 {
+		return map[string][]int32{topic: append([]int32(nil), s.assigned[topic]...)}
+	}
+	return map[string][]int32{topic: append([]int32(nil), partitions...)}
+}
+
+func (s *pauseState) copyAssigned() map[string][]int32 {
+	out := make(map[string][]int32, len(s.assigned))
+	for topic, partitions := range s.assigned {
+		out[topic] = append([]int32(nil), partitions...)
+	}
+	return out
+}
+
+// PartitionAssignment describes one partition owned by this member.
+type PartitionAssignment struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Paused    bool   `json:"paused"`
+}
+
+func (s *pauseState) snapshot() []PartitionAssignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []PartitionAssignment
+	for topic, partitions := range s.assigned {
+		for _, p := range partitions {
+			out = append(out, PartitionAssignment{
+				Topic:     topic,
+				Partition: p,
+				Paused:    s.all || s.partitions[topic][p],
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Topic != out[j].Topic {
+			return out[i].Topic < out[j].Topic
+		}
+		return out[i].Partition < out[j].Partition
+	})
+	return out
+}
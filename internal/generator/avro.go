@@ -0,0 +1,289 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// avroEncoder encodes Avro datums in the Confluent wire format. Template
+// documents must use the Avro JSON encoding, i.e. non-null union values are
+// wrapped as {"type": value}.
+type avroEncoder struct {
+	codec  *goavro.Codec
+	schema any
+	named  map[string]map[string]any
+	ids    map[string]uint32
+	rng    *rand.Rand
+}
+
+func newAvroEncoder(ctx context.Context, cfg Config, rng *rand.Rand) (*avroEncoder, error) {
+	raw, err := os.ReadFile(cfg.AvroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("read avro schema: %w", err)
+	}
+	codec, err := goavro.NewCodec(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse avro schema: %w", err)
+	}
+	e := &avroEncoder{codec: codec, named: make(map[string]map[string]any), ids: make(map[string]uint32), rng: rng}
+	if err := json.Unmarshal(raw, &e.schema); err != nil {
+		return nil, fmt.Errorf("parse avro schema: %w", err)
+	}
+	e.collectNamed(e.schema, "")
+
+	bySubject := make(map[string]uint32)
+	for _, t := range cfg.Topics {
+		subj := subject(cfg, t.Name)
+		id, ok := bySubject[subj]
+		switch {
+		case ok:
+		case cfg.SchemaRegistryURL != "":
+			if id, err = registerSchema(ctx, cfg.SchemaRegistryURL, subj, "", codec.CanonicalSchema()); err != nil {
+				return nil, err
+			}
+			slog.Info("registered avro schema", "subject", subj, "id", id)
+		default:
+			// Local stand-in for a registry: every subject gets the configured
+			// id, 1 by default.
+			id = uint32(max(cfg.SchemaID, 1))
+		}
+		bySubject[subj], e.ids[t.Name] = id, id
+	}
+	return e, nil
+}
+
+func (e *avroEncoder) Encode(topic string, doc []byte) ([]byte, error) {
+	var native any
+	if doc != nil {
+		var err error
+		if native, _, err = e.codec.NativeFromTextual(doc); err != nil {
+			return nil, fmt.Errorf("convert payload to avro: %w", err)
+		}
+	} else {
+		native = e.random(e.schema, "", 0)
+	}
+	out, err := e.codec.BinaryFromNative(appendConfluentHeader(make([]byte, 0, 256), e.ids[topic]), native)
+	if err != nil {
+		return nil, fmt.Errorf("encode avro: %w", err)
+	}
+	return out, nil
+}
+
+// maxRandomDepth stops recursive schemas from generating ever deeper values:
+// below it unions prefer null and arrays and maps are empty.
+const maxRandomDepth = 4
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// collectNamed indexes record, enum and fixed definitions by full name so
+// later references to them can be resolved.
+func (e *avroEncoder) collectNamed(schema any, namespace string) {
+	switch s := schema.(type) {
+	case []any:
+		for _, branch := range s {
+			e.collectNamed(branch, namespace)
+		}
+	case map[string]any:
+		switch s["type"] {
+		case "record", "error", "enum", "fixed":
+			name := fullName(s, namespace)
+			e.named[name] = s
+			namespace = name[:max(strings.LastIndex(name, "."), 0)]
+			fields, _ := s["fields"].([]any)
+			for _, f := range fields {
+				if field, ok := f.(map[string]any); ok {
+					e.collectNamed(field["type"], namespace)
+				}
+			}
+		case "array":
+			e.collectNamed(s["items"], namespace)
+		case "map":
+			e.collectNamed(s["values"], namespace)
+		default:
+			e.collectNamed(s["type"], namespace)
+		}
+	}
+}
+
+func fullName(s map[string]any, namespace string) string {
+	name, _ := s["name"].(string)
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if ns, ok := s["namespace"].(string); ok {
+		namespace = ns
+	}
+	if namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func (e *avroEncoder) lookup(name, namespace string) map[string]any {
+	if !strings.Contains(name, ".") && namespace != "" {
+		if s, ok := e.named[namespace+"."+name]; ok {
+			return s
+		}
+	}
+	return e.named[name]
+}
+
+// random builds a native goavro value for schema.
+func (e *avroEncoder) random(schema any, namespace string, depth int) any {
+	switch s := schema.(type) {
+	case string:
+		if avroPrimitives[s] {
+			return e.randomPrimitive(s)
+		}
+		if named := e.lookup(s, namespace); named != nil {
+			return e.random(named, namespace, depth)
+		}
+		return nil
+	case []any:
+		if len(s) == 0 {
+			return nil
+		}
+		branch := s[e.rng.Intn(len(s))]
+		if depth >= maxRandomDepth {
+			for _, b := range s {
+				if b == "null" {
+					branch = b
+				}
+			}
+		}
+		if branch == "null" {
+			return nil
+		}
+		return goavro.Union(e.unionName(branch, namespace), e.random(branch, namespace, depth))
+	case map[string]any:
+		if logical, ok := s["logicalType"].(string); ok {
+			if v, ok := e.randomLogical(logical, s); ok {
+				return v
+			}
+		}
+		switch s["type"] {
+		case "record", "error":
+			name := fullName(s, namespace)
+			namespace = name[:max(strings.LastIndex(name, "."), 0)]
+			fields, _ := s["fields"].([]any)
+			out := make(map[string]any, len(fields))
+			for _, f := range fields {
+				field, _ := f.(map[string]any)
+				fieldName, _ := field["name"].(string)
+				out[fieldName] = e.random(field["type"], namespace, depth+1)
+			}
+			return out
+		case "enum":
+			symbols, _ := s["symbols"].([]any)
+			if len(symbols) == 0 {
+				return nil
+			}
+			return symbols[e.rng.Intn(len(symbols))]
+		case "array":
+			out := make([]any, e.count(depth))
+			for i := range out {
+				out[i] = e.random(s["items"], namespace, depth+1)
+			}
+			return out
+		case "map":
+			out := make(map[string]any)
+			for i := e.count(depth); i > 0; i-- {
+				out[randomText(e.rng, 6)] = e.random(s["values"], namespace, depth+1)
+			}
+			return out
+		case "fixed":
+			size, _ := s["size"].(float64)
+			b := make([]byte, int(size))
+			e.rng.Read(b)
+			return b
+		default:
+			return e.random(s["type"], namespace, depth)
+		}
+	}
+	return nil
+}
+
+func (e *avroEncoder) count(depth int) int {
+	if depth >= maxRandomDepth {
+		return 0
+	}
+	return e.rng.Intn(4)
+}
+
+func (e *avroEncoder) randomPrimitive(name string) any {
+	switch name {
+	case "boolean":
+		return e.rng.Intn(2) == 1
+	case "int":
+		return int32(e.rng.Intn(1000))
+	case "long":
+		return e.rng.Int63n(1_000_000)
+	case "float":
+		return e.rng.Float32() * 1000
+	case "double":
+		return e.rng.Float64() * 1000
+	case "bytes":
+		b := make([]byte, 8)
+		e.rng.Read(b)
+		return b
+	case "string":
+		return randomText(e.rng, 8+e.rng.Intn(9))
+	default:
+		return nil
+	}
+}
+
+// randomLogical returns a value for the logical types goavro converts from
+// native Go types; unknown ones fall back to their underlying type.
+func (e *avroEncoder) randomLogical(logical string, s map[string]any) (any, bool) {
+	switch logical {
+	case "timestamp-millis", "timestamp-micros", "date":
+		return time.Now().UTC().Add(-time.Duration(e.rng.Int63n(int64(24 * time.Hour)))), true
+	case "time-millis", "time-micros":
+		return time.Duration(e.rng.Int63n(int64(24 * time.Hour))).Truncate(time.Millisecond), true
+	case "uuid":
+		return templateFuncs(e.rng)["uuid"].(func() string)(), true
+	case "decimal":
+		scale, _ := s["scale"].(float64)
+		denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+		return new(big.Rat).SetFrac(big.NewInt(e.rng.Int63n(1_000_000)), denom), true
+	}
+	return nil, false
+}
+
+// unionName is the branch name goavro expects when wrapping a union value.
+func (e *avroEncoder) unionName(branch any, namespace string) string {
+	switch b := branch.(type) {
+	case string:
+		if avroPrimitives[b] {
+			return b
+		}
+		if named := e.lookup(b, namespace); named != nil {
+			return fullName(named, namespace)
+		}
+		return b
+	case map[string]any:
+		typ, _ := b["type"].(string)
+		switch typ {
+		case "record", "error", "enum", "fixed":
+			return fullName(b, namespace)
+		}
+		if logical, ok := b["logicalType"].(string); ok {
+			return typ + "." + logical
+		}
+		return typ
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// CaptureOptions select the topic range dumped by Capture.
+type CaptureOptions struct {
+	Topic string
+	// Partitions to read; empty means all of them.
+	Partitions []int32
+	// Start and End bound each partition: "oldest", "newest", an offset, or
+	// an RFC 3339 time. Start is inclusive, End exclusive; "newest" is the
+	// high watermark when the capture begins.
+	Start string
+	End   string
+	// Limit stops the capture after this many records; 0 means no limit.
+	Limit int64
+}
+
+// captureIdle is how long a partition may stay silent before its range is
+// treated as finished, e.g. when it ends in transaction markers.
+const captureIdle = 5 * time.Second
+
+// partitionRange is the half-open offset range captured from one partition.
+type partitionRange struct {
+	partition  int32
+	start, end int64
+}
+
+// Capture consumes the configured range and writes it to w ordered by
+// message timestamp across partitions. Record times are relative to the
+// first record written. It returns the number of records written.
+func Capture(ctx context.Context, client sarama.Client, opts CaptureOptions, w RecordWriter) (int64, error) {
+	ranges, err := captureRanges(client, opts)
+	if err != nil {
+		return 0, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return 0, fmt.Errorf("create consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	type source struct {
+		partitionRange
+		pc   sarama.PartitionConsumer
+		head *sarama.ConsumerMessage
+		// last is set once the message at end-1 has been read.
+		last bool
+	}
+	var sources []*source
+	for _, r := range ranges {
+		slog.Info("capturing partition", "topic", opts.Topic, "partition", r.partition, "start", r.start, "end", r.end)
+		if r.start >= r.end {
+			continue
+		}
+		pc, err := consumer.ConsumePartition(opts.Topic, r.partition, r.start)
+		if err != nil {
+			return 0, fmt.Errorf("consume partition %d: %w", r.partition, err)
+		}
+		defer pc.Close()
+		sources = append(sources, &source{partitionRange: r, pc: pc})
+	}
+
+	var (
+		written int64
+		origin  time.Time
+	)
+	for len(sources) > 0 && (opts.Limit == 0 || written < opts.Limit) {
+		// Every partition needs a head before the oldest can be picked.
+		active := sources[:0]
+		for _, s := range sources {
+			if s.head == nil {
+				if s.last {
+					continue
+				}
+				msg, err := nextInRange(ctx, s.pc, s.partition, s.end)
+				if err != nil {
+					return written, fmt.Errorf("partition %d: %w", s.partition, err)
+				}
+				if msg == nil {
+					continue
+				}
+				s.head, s.last = msg, msg.Offset >= s.end-1
+			}
+			active = append(active, s)
+		}
+		sources = active
+		if len(sources) == 0 {
+			break
+		}
+
+		oldest := sources[0]
+		for _, s := range sources[1:] {
+			if s.head.Timestamp.Before(oldest.head.Timestamp) {
+				oldest = s
+			}
+		}
+		msg := oldest.head
+		oldest.head = nil
+
+		rec := Record{Key: msg.Key, Value: msg.Value}
+		if !msg.Timestamp.IsZero() {
+			if origin.IsZero() {
+				origin = msg.Timestamp
+			}
+			rec.At, rec.Timed = msg.Timestamp.Sub(origin), true
+		}
+		for _, h := range msg.Headers {
+			rec.Headers = append(rec.Headers, Header{Key: h.Key, Value: h.Value})
+		}
+		if err := w.Write(rec); err != nil {
+			return written, fmt.Errorf("write record: %w", err)
+		}
+		written++
+	}
+	return written, w.Flush()
+}
+
+// nextInRange returns the next message below end, or nil once the partition
+// has passed end or stayed idle for captureIdle.
+func nextInRange(ctx context.Context, pc sarama.PartitionConsumer, partition int32, end int64) (*sarama.ConsumerMessage, error) {
+	idle := time.NewTimer(captureIdle)
+	defer idle.Stop()
+	select {
+	case msg := <-pc.Messages():
+		if msg.Offset >= end {
+			return nil, nil
+		}
+		return msg, nil
+	case err := <-pc.Errors():
+		return nil, err
+	case <-idle.C:
+		slog.Warn("partition idle before end of range; moving on", "partition", partition, "end", end)
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func captureRanges(client sarama.Client, opts CaptureOptions) ([]partitionRange, error) {
+	partitions := opts.Partitions
+	if len(partitions) == 0 {
+		var err error
+		if partitions, err = client.Partitions(opts.Topic); err != nil {
+			return nil, fmt.Errorf("list partitions: %w", err)
+		}
+	}
+	ranges := make([]partitionRange, 0, len(partitions))
+	for _, p := range partitions {
+		oldest, err := client.GetOffset(opts.Topic, p, sarama.OffsetOldest)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: oldest offset: %w", p, err)
+		}
+		newest, err := client.GetOffset(opts.Topic, p, sarama.OffsetNewest)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: newest offset: %w", p, err)
+		}
+		start, err := resolveOffset(client, opts.Topic, p, opts.Start, oldest, newest)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: GEN_CAPTURE_START: %w", p, err)
+		}
+		end, err := resolveOffset(client, opts.Topic, p, opts.End, oldest, newest)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: GEN_CAPTURE_END: %w", p, err)
+		}
+		ranges = append(ranges, partitionRange{partition: p, start: start, end: end})
+	}
+	return ranges, nil
+}
+
+// resolveOffset turns a range bound into an offset clamped to
+// [oldest, newest].
+func resolveOffset(client sarama.Client, topic string, partition int32, bound string, oldest, newest int64) (int64, error) {
+	switch strings.ToLower(bound) {
+	case "oldest":
+		return oldest, nil
+	case "newest":
+		return newest, nil
+	}
+	if offset, err := strconv.ParseInt(bound, 10, 64); err == nil {
+		return min(max(offset, oldest), newest), nil
+	}
+	at, err := time.Parse(time.RFC3339Nano, bound)
+	if err != nil {
+		return 0, fmt.Errorf("want oldest, newest, an offset or an RFC 3339 time, got %q", bound)
+	}
+	offset, err := client.GetOffset(topic, partition, at.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		// Nothing at or after the time yet.
+		return newest, nil
+	}
+	return offset, nil
+}
+
+// ParsePartitions parses a comma-separated list of partition numbers.
+func ParsePartitions(raw string) ([]int32, error) {
+	var out []int32
+	for _, item := range splitAndTrim(raw) {
+		p, err := strconv.ParseInt(item, 10, 32)
+		if err != nil || p < 0 {
+			return nil, fmt.Errorf("invalid partition %q", item)
+		}
+		out = append(out, int32(p))
+	}
+	return out, nil
+}
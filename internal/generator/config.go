@@ -8,26 +8,147 @@ import (
 	"time"
 )
 
+// Generator modes selected with GEN_MODE.
+const (
+	// ModeGenerate produces synthetic messages.
+	ModeGenerate = "generate"
+	// ModeReplay produces the records in GEN_CAPTURE_FILE.
+	ModeReplay = "replay"
+	// ModeCapture dumps a range of KAFKA_TOPIC into GEN_CAPTURE_FILE.
+	ModeCapture = "capture"
+	// ModeCoordinate serves a distributed run on GEN_COORDINATOR_ADDR:
+	// GEN_INSTANCES generators register, split the load and report back.
+	ModeCoordinate = "coordinate"
+)
+
+// Producer acknowledgement levels selected with GEN_ACKS.
+const (
+	AcksNone  = "none"
+	AcksLocal = "local"
+	AcksAll   = "all"
+)
+
 type Config struct {
-	Brokers       []string
-	Topic         string
-	KafkaVersion  string
-	MessageRate   int
-	MessageSize   int
-	TotalMessages int
-	KeyPrefix     string
-	Compression   string
-	ClientID      string
-	LogInterval   time.Duration
+	Mode            string
+	Brokers         []string
+	Topic           string
+	KafkaVersion    string
+	MessageRate     int
+	MessageSize     int
+	TotalMessages   int
+	KeyPrefix       string
+	Compression     string
+	ClientID        string
+	LogInterval     time.Duration
+	LogFormat       string
+	LogLevel        string
+	LogRepeatLimit  int
+	LogRepeatWindow time.Duration
+
+	PayloadTemplate string
+
+	// PayloadEncoding is json, avro or protobuf. Avro needs AvroSchema;
+	// protobuf needs ProtoDescriptor, a FileDescriptorSet, and ProtoMessage.
+	PayloadEncoding string
+	AvroSchema      string
+	ProtoDescriptor string
+	ProtoMessage    string
+	// SchemaRegistryURL registers schemas and takes their ids from the
+	// registry; without it every subject uses SchemaID.
+	SchemaRegistryURL string
+	SchemaSubject     string
+	SchemaID          int
+
+	// Acks is none, local or all; it defaults to all for idempotent and
+	// transactional producers and local otherwise.
+	Acks       string
+	Idempotent bool
+	// TransactionalID enables transactions of TxnSize messages, a fraction
+	// TxnAbortRate of which are aborted on purpose.
+	TransactionalID string
+	TxnSize         int
+	TxnAbortRate    float64
+
+	// Topics is the weighted fan-out from GEN_TOPICS; it defaults to Topic
+	// alone. Capture and replay always use Topic.
+	Topics  []WeightedTopic
+	Headers string
+
+	// RateSchedule is the raw GEN_RATE_SCHEDULE; Schedule holds its parsed
+	// phases, or a single constant phase at MessageRate when unset.
+	RateSchedule string
+	Schedule     []Phase
+	MetricsAddr  string
+
+	ReportFile   string
+	ReportFormat string
+
+	// CoordinatorURL joins the run of a coordinator; CoordinatorAddr is
+	// where a coordinator listens.
+	CoordinatorURL     string
+	CoordinatorAddr    string
+	CoordinatorTimeout time.Duration
+	InstanceID         string
+	StartDelay         time.Duration
+	// Instance is this generator's zero-based index among Instances. A
+	// coordinator sets both; standalone runs are instance 0 of 1.
+	Instance  int
+	Instances int
+
+	KeyMode        string
+	KeyCardinality int
+	KeyZipfS       float64
+	KeyTenants     int
+	KeyFile        string
+
+	CaptureFile       string
+	CaptureFormat     string
+	CapturePartitions []int32
+	CaptureStart      string
+	CaptureEnd        string
+	// ReplaySpeed scales recorded gaps: 1 is original speed, 2 twice as
+	// fast, 0 as fast as possible.
+	ReplaySpeed float64
+
+	Verify             bool
+	VerifyDSN          string
+	VerifyTable        string
+	VerifyTimeout      time.Duration
+	VerifyPollInterval time.Duration
 }
 
 func FromEnv() (Config, error) {
 	cfg := Config{
-		Topic:        getenv("KAFKA_TOPIC", "staging.events"),
-		KafkaVersion: getenv("KAFKA_VERSION", "3.6.1"),
-		KeyPrefix:    getenv("GEN_KEY_PREFIX", "loadgen"),
-		Compression:  strings.ToLower(getenv("GEN_COMPRESSION", "none")),
-		ClientID:     getenv("GEN_CLIENT_ID", "load-generator"),
+		Mode:            strings.ToLower(getenv("GEN_MODE", ModeGenerate)),
+		Topic:           getenv("KAFKA_TOPIC", "staging.events"),
+		KafkaVersion:    getenv("KAFKA_VERSION", "3.6.1"),
+		KeyPrefix:       getenv("GEN_KEY_PREFIX", "loadgen"),
+		Compression:     strings.ToLower(getenv("GEN_COMPRESSION", "none")),
+		Acks:            strings.ToLower(getenv("GEN_ACKS", "")),
+		TransactionalID: getenv("GEN_TRANSACTIONAL_ID", ""),
+		ClientID:        getenv("GEN_CLIENT_ID", "load-generator"),
+		LogFormat:       strings.ToLower(getenv("LOG_FORMAT", "text")),
+		LogLevel:        strings.ToLower(getenv("LOG_LEVEL", "info")),
+		PayloadTemplate: getenv("GEN_PAYLOAD_TEMPLATE", ""),
+		PayloadEncoding: strings.ToLower(getenv("GEN_PAYLOAD_ENCODING", EncodingJSON)),
+		AvroSchema:      getenv("GEN_AVRO_SCHEMA", ""),
+		ProtoDescriptor: getenv("GEN_PROTO_DESCRIPTOR", ""),
+		ProtoMessage:    getenv("GEN_PROTO_MESSAGE", ""),
+		Headers:         getenv("GEN_HEADERS", ""),
+		RateSchedule:    getenv("GEN_RATE_SCHEDULE", ""),
+		MetricsAddr:     getenv("GEN_METRICS_ADDR", ""),
+		ReportFile:      getenv("GEN_REPORT_FILE", ""),
+		CoordinatorURL:  getenv("GEN_COORDINATOR_URL", ""),
+		CoordinatorAddr: getenv("GEN_COORDINATOR_ADDR", ":8095"),
+		InstanceID:      getenv("GEN_INSTANCE_ID", defaultInstanceID()),
+		KeyMode:         strings.ToLower(getenv("GEN_KEY_MODE", KeyModeUnique)),
+		KeyFile:         getenv("GEN_KEY_FILE", ""),
+		CaptureFile:     getenv("GEN_CAPTURE_FILE", ""),
+		CaptureFormat:   strings.ToLower(getenv("GEN_CAPTURE_FORMAT", FormatNDJSON)),
+		CaptureStart:    getenv("GEN_CAPTURE_START", "oldest"),
+		CaptureEnd:      getenv("GEN_CAPTURE_END", "newest"),
+		VerifyDSN:       getenv("DATABASE_URL", ""),
+		VerifyTable:     getenv("DB_TABLE", "kafka_events"),
 	}
 
 	brokersRaw := getenv("KAFKA_BROKERS", "localhost:29092")
@@ -42,10 +163,18 @@ func FromEnv() (Config, error) {
 	}
 
 	var err error
+	if cfg.Topics, err = ParseTopics(getenv("GEN_TOPICS", cfg.Topic)); err != nil {
+		return Config{}, fmt.Errorf("GEN_TOPICS: %w", err)
+	}
+
 	if cfg.MessageRate, err = parsePositiveInt("GEN_MESSAGE_RATE", 1000); err != nil {
 		return Config{}, err
 	}
 
+	if cfg.Schedule, err = buildSchedule(cfg.RateSchedule, cfg.MessageRate); err != nil {
+		return Config{}, err
+	}
+
 	if cfg.MessageSize, err = parsePositiveInt("GEN_MESSAGE_SIZE", 512); err != nil {
 		return Config{}, err
 	}
@@ -58,9 +187,165 @@ func FromEnv() (Config, error) {
 		return Config{}, err
 	}
 
+	if cfg.LogRepeatLimit, err = parseNonNegativeInt("LOG_REPEAT_LIMIT", 5); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.LogRepeatWindow, err = parseDuration("LOG_REPEAT_WINDOW", "10s"); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.KeyCardinality, err = parsePositiveInt("GEN_KEY_CARDINALITY", 10000); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.KeyZipfS, err = parseFloat("GEN_KEY_ZIPF_S", 1.2); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.KeyTenants, err = parsePositiveInt("GEN_KEY_TENANTS", 100); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.KeyMode == KeyModeFile && cfg.KeyFile == "" {
+		return Config{}, fmt.Errorf("GEN_KEY_FILE must be provided when GEN_KEY_MODE=file")
+	}
+
+	switch cfg.PayloadEncoding {
+	case EncodingJSON:
+	case EncodingAvro:
+		if cfg.AvroSchema == "" {
+			return Config{}, fmt.Errorf("GEN_AVRO_SCHEMA must be provided when GEN_PAYLOAD_ENCODING=avro")
+		}
+	case EncodingProtobuf:
+		if cfg.ProtoDescriptor == "" || cfg.ProtoMessage == "" {
+			return Config{}, fmt.Errorf("GEN_PROTO_DESCRIPTOR and GEN_PROTO_MESSAGE must be provided when GEN_PAYLOAD_ENCODING=protobuf")
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported GEN_PAYLOAD_ENCODING %q", cfg.PayloadEncoding)
+	}
+	cfg.SchemaRegistryURL = getenv("GEN_SCHEMA_REGISTRY_URL", "")
+	cfg.SchemaSubject = getenv("GEN_SCHEMA_SUBJECT", "")
+	if cfg.SchemaID, err = parseNonNegativeInt("GEN_SCHEMA_ID", 0); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Idempotent, err = parseBool("GEN_IDEMPOTENT", cfg.TransactionalID != ""); err != nil {
+		return Config{}, err
+	}
+	if cfg.TransactionalID != "" && !cfg.Idempotent {
+		return Config{}, fmt.Errorf("GEN_TRANSACTIONAL_ID requires GEN_IDEMPOTENT")
+	}
+	switch {
+	case cfg.Acks == "" && cfg.Idempotent:
+		cfg.Acks = AcksAll
+	case cfg.Acks == "":
+		cfg.Acks = AcksLocal
+	case cfg.Acks != AcksNone && cfg.Acks != AcksLocal && cfg.Acks != AcksAll:
+		return Config{}, fmt.Errorf("GEN_ACKS must be %s, %s or %s", AcksNone, AcksLocal, AcksAll)
+	case cfg.Idempotent && cfg.Acks != AcksAll:
+		return Config{}, fmt.Errorf("GEN_IDEMPOTENT requires GEN_ACKS=%s", AcksAll)
+	}
+
+	if cfg.TxnSize, err = parsePositiveInt("GEN_TXN_SIZE", 100); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.TxnAbortRate, err = parseFloat("GEN_TXN_ABORT_RATE", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.TxnAbortRate < 0 || cfg.TxnAbortRate > 1 {
+		return Config{}, fmt.Errorf("GEN_TXN_ABORT_RATE must be between 0 and 1")
+	}
+
+	if cfg.StartDelay, err = parseDuration("GEN_START_DELAY", "5s"); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.CoordinatorTimeout, err = parseDuration("GEN_COORDINATOR_TIMEOUT", "30m"); err != nil {
+		return Config{}, err
+	}
+
+	cfg.Instances = 1
+	switch cfg.Mode {
+	case ModeGenerate:
+	case ModeCoordinate:
+		if cfg.Instances, err = parsePositiveInt("GEN_INSTANCES", 1); err != nil {
+			return Config{}, err
+		}
+		if cfg.TotalMessages > 0 && cfg.TotalMessages < cfg.Instances {
+			return Config{}, fmt.Errorf("GEN_TOTAL_MESSAGES must be 0 or at least GEN_INSTANCES")
+		}
+	case ModeReplay, ModeCapture:
+		if cfg.CaptureFile == "" {
+			return Config{}, fmt.Errorf("GEN_CAPTURE_FILE must be provided when GEN_MODE=%s", cfg.Mode)
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported GEN_MODE %q", cfg.Mode)
+	}
+	if cfg.CoordinatorURL != "" && cfg.Mode != ModeGenerate {
+		return Config{}, fmt.Errorf("GEN_COORDINATOR_URL requires GEN_MODE=%s", ModeGenerate)
+	}
+
+	if cfg.CaptureFormat != FormatNDJSON && cfg.CaptureFormat != FormatLengthPrefixed {
+		return Config{}, fmt.Errorf("GEN_CAPTURE_FORMAT must be %s or %s", FormatNDJSON, FormatLengthPrefixed)
+	}
+
+	if cfg.CapturePartitions, err = ParsePartitions(getenv("GEN_CAPTURE_PARTITIONS", "")); err != nil {
+		return Config{}, fmt.Errorf("GEN_CAPTURE_PARTITIONS: %w", err)
+	}
+
+	if cfg.ReplaySpeed, err = parseFloat("GEN_REPLAY_SPEED", 1); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReplaySpeed < 0 {
+		return Config{}, fmt.Errorf("GEN_REPLAY_SPEED must be >= 0")
+	}
+
+	cfg.ReportFormat = ReportFormat(cfg.ReportFile, strings.ToLower(getenv("GEN_REPORT_FORMAT", "")))
+	if cfg.ReportFormat != ReportJSON && cfg.ReportFormat != ReportCSV {
+		return Config{}, fmt.Errorf("GEN_REPORT_FORMAT must be %s or %s", ReportJSON, ReportCSV)
+	}
+
+	if cfg.Verify, err = parseBool("GEN_VERIFY", false); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.VerifyTimeout, err = parseDuration("GEN_VERIFY_TIMEOUT", "2m"); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.VerifyPollInterval, err = parseDuration("GEN_VERIFY_POLL_INTERVAL", "2s"); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.Verify && cfg.VerifyDSN == "" {
+		return Config{}, fmt.Errorf("DATABASE_URL must be provided when GEN_VERIFY is set")
+	}
+
 	return cfg, nil
 }
 
+// buildSchedule parses spec, or paces a constant rate when it is empty.
+func buildSchedule(spec string, rate int) ([]Phase, error) {
+	if spec == "" {
+		return []Phase{{Kind: PhaseConstant, From: float64(rate), To: float64(rate)}}, nil
+	}
+	phases, err := ParseSchedule(spec)
+	if err != nil {
+		return nil, fmt.Errorf("GEN_RATE_SCHEDULE: %w", err)
+	}
+	return phases, nil
+}
+
+func defaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "generator"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getenv(key, fallback string) string {
 	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
 		return v
@@ -124,3 +409,27 @@ func parseDuration(key, fallback string) (time.Duration, error) {
 	}
 	return d, nil
 }
+
+func parseBool(key string, fallback bool) (bool, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s must be a boolean", key)
+	}
+	return parsed, nil
+}
+
+func parseFloat(key string, fallback float64) (float64, error) {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", key)
+	}
+	return parsed, nil
+}
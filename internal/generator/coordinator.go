@@ -0,0 +1,391 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Assignment is what a coordinator hands each registered generator.
+type Assignment struct {
+	RunID     string `json:"run_id"`
+	Instance  int    `json:"instance"`
+	Instances int    `json:"instances"`
+	// MessageRate, RateSchedule and TotalMessages are the totals for the
+	// whole run; Apply takes this instance's share.
+	MessageRate   int       `json:"message_rate"`
+	RateSchedule  string    `json:"rate_schedule"`
+	TotalMessages int       `json:"total_messages"`
+	StartAt       time.Time `json:"start_at"`
+}
+
+// Apply configures cfg as the assigned instance.
+func (a Assignment) Apply(cfg *Config) error {
+	phases, err := buildSchedule(a.RateSchedule, a.MessageRate)
+	if err != nil {
+		return err
+	}
+	cfg.Instance, cfg.Instances = a.Instance, a.Instances
+	cfg.MessageRate, cfg.RateSchedule = a.MessageRate, a.RateSchedule
+	cfg.Schedule = ShareSchedule(phases, a.Instance, a.Instances)
+	cfg.TotalMessages = int(Share(int64(a.TotalMessages), a.Instance, a.Instances))
+	return nil
+}
+
+// InstanceReport is what a generator sends back at the end of a
+// coordinated run. The raw latency histogram lets the coordinator merge
+// percentiles exactly.
+type InstanceReport struct {
+	Instance       int           `json:"instance"`
+	Report         RunReport     `json:"report"`
+	LatencyBuckets map[int]int64 `json:"latency_buckets"`
+	LatencyMax     time.Duration `json:"latency_max"`
+}
+
+// InstanceReport snapshots the statistics for instance's part of a
+// coordinated run.
+func (r *Recorder) InstanceReport(instance int, runID string, cfg Config) InstanceReport {
+	report := r.Report(runID, cfg)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := InstanceReport{Instance: instance, Report: report, LatencyBuckets: make(map[int]int64, len(r.latency.buckets)), LatencyMax: r.latency.max}
+	for b, n := range r.latency.buckets {
+		out.LatencyBuckets[b] = n
+	}
+	return out
+}
+
+// registerPoll bounds how long a registration request is held open waiting
+// for the other instances; clients simply register again.
+const registerPoll = 30 * time.Second
+
+// Coordinator runs a distributed generator run: it waits for cfg.Instances
+// generators to register, hands each its share and a common start time,
+// and merges their reports.
+type Coordinator struct {
+	cfg   Config
+	runID string
+
+	mu      sync.Mutex
+	members map[string]int
+	startAt time.Time
+	ready   chan struct{}
+	reports map[int]InstanceReport
+	done    chan struct{}
+}
+
+// NewCoordinator creates the coordinator of run runID.
+func NewCoordinator(runID string, cfg Config) *Coordinator {
+	return &Coordinator{
+		cfg:     cfg,
+		runID:   runID,
+		members: make(map[string]int),
+		ready:   make(chan struct{}),
+		reports: make(map[int]InstanceReport),
+		done:    make(chan struct{}),
+	}
+}
+
+// Handler serves the coordination API:
+//
+//	POST /register  {"id": ...}          long-polls until every instance has
+//	                                     registered, then returns an Assignment
+//	POST /report    InstanceReport       records an instance's report
+//	GET  /status                         registration and report progress
+func (c *Coordinator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", c.handleRegister)
+	mux.HandleFunc("/report", c.handleReport)
+	mux.HandleFunc("/status", c.handleStatus)
+	return mux
+}
+
+func (c *Coordinator) handleRegister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == "" {
+		http.Error(w, "body must be {\"id\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	instance, ok := c.members[req.ID]
+	if !ok {
+		if len(c.members) == c.cfg.Instances {
+			c.mu.Unlock()
+			http.Error(w, fmt.Sprintf("run already has %d instances", c.cfg.Instances), http.StatusConflict)
+			return
+		}
+		instance = len(c.members)
+		c.members[req.ID] = instance
+		slog.Info("instance registered", "id", req.ID, "instance", instance, "registered", len(c.members), "of", c.cfg.Instances)
+		if len(c.members) == c.cfg.Instances {
+			c.startAt = time.Now().Add(c.cfg.StartDelay).UTC()
+			close(c.ready)
+			slog.Info("all instances registered", "start_at", c.startAt)
+		}
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-c.ready:
+	case <-time.After(registerPoll):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "waiting for instances", http.StatusServiceUnavailable)
+		return
+	case <-r.Context().Done():
+		return
+	}
+	writeJSON(w, Assignment{
+		RunID:         c.runID,
+		Instance:      instance,
+		Instances:     c.cfg.Instances,
+		MessageRate:   c.cfg.MessageRate,
+		RateSchedule:  c.cfg.RateSchedule,
+		TotalMessages: c.cfg.TotalMessages,
+		StartAt:       c.startAt,
+	})
+}
+
+func (c *Coordinator) handleReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var report InstanceReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, "invalid report: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if report.Instance < 0 || report.Instance >= c.cfg.Instances {
+		http.Error(w, fmt.Sprintf("instance %d out of range", report.Instance), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.reports[report.Instance]; !ok {
+		c.reports[report.Instance] = report
+		slog.Info("instance reported", "instance", report.Instance, "produced", report.Report.Produced,
+			"acked", report.Report.Acked, "errors", report.Report.Errors, "reported", len(c.reports), "of", c.cfg.Instances)
+		if len(c.reports) == c.cfg.Instances {
+			close(c.done)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Coordinator) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status := map[string]any{
+		"run_id":     c.runID,
+		"instances":  c.cfg.Instances,
+		"registered": len(c.members),
+		"reported":   len(c.reports),
+	}
+	if !c.startAt.IsZero() {
+		status["start_at"] = c.startAt
+	}
+	writeJSON(w, status)
+}
+
+// Wait blocks until every instance has reported or ctx is done, and merges
+// the reports received. The error reports instances that never did.
+func (c *Coordinator) Wait(ctx context.Context) (RunReport, error) {
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reports := make([]InstanceReport, 0, len(c.reports))
+	var missing []string
+	for i := 0; i < c.cfg.Instances; i++ {
+		if r, ok := c.reports[i]; ok {
+			reports = append(reports, r)
+		} else {
+			missing = append(missing, fmt.Sprint(i))
+		}
+	}
+	var err error
+	if len(missing) > 0 {
+		err = fmt.Errorf("no report from instances %s", strings.Join(missing, ","))
+	}
+	return MergeReports(c.runID, c.cfg, reports), err
+}
+
+// InstanceSummary is one generator's totals in a merged report.
+type InstanceSummary struct {
+	Instance int    `json:"instance"`
+	RunID    string `json:"run_id"`
+	Produced int64  `json:"produced"`
+	Acked    int64  `json:"acked"`
+	Errors   int64  `json:"errors"`
+}
+
+// MergeReports combines instance reports into one report for the run.
+// Counts and per-second rows add up; verification latencies are the worst
+// instance's, since only their percentiles are reported.
+func MergeReports(runID string, cfg Config, reports []InstanceReport) RunReport {
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Instance < reports[j].Instance })
+	out := RunReport{RunID: runID, Mode: cfg.Mode, ErrorsByType: make(map[string]int64), Config: cfg.Settings()}
+	var latency latencyHistogram
+	for _, ir := range reports {
+		r := ir.Report
+		if out.Started.IsZero() || r.Started.Before(out.Started) {
+			out.Started = r.Started
+		}
+		if r.Finished.After(out.Finished) {
+			out.Finished = r.Finished
+		}
+		out.Produced += r.Produced
+		out.Acked += r.Acked
+		out.Errors += r.Errors
+		for k, v := range r.ErrorsByType {
+			out.ErrorsByType[k] += v
+		}
+		for _, s := range r.PerSecond {
+			for len(out.PerSecond) <= s.Second {
+				out.PerSecond = append(out.PerSecond, SecondStats{Second: len(out.PerSecond)})
+			}
+			out.PerSecond[s.Second].Produced += s.Produced
+			out.PerSecond[s.Second].Acked += s.Acked
+			out.PerSecond[s.Second].Errors += s.Errors
+		}
+		for b, n := range ir.LatencyBuckets {
+			if latency.buckets == nil {
+				latency.buckets = make(map[int]int64)
+			}
+			latency.buckets[b] += n
+			latency.count += n
+		}
+		latency.max = max(latency.max, ir.LatencyMax)
+		if r.Verification != nil {
+			out.Verification = mergeVerification(runID, out.Verification, r.Verification)
+		}
+		out.Instances = append(out.Instances, InstanceSummary{
+			Instance: ir.Instance,
+			RunID:    r.RunID,
+			Produced: r.Produced,
+			Acked:    r.Acked,
+			Errors:   r.Errors,
+		})
+	}
+	out.Seconds = float64(out.Finished.Sub(out.Started).Milliseconds()) / 1000
+	out.AckLatencyMS = latency.percentiles()
+	return out
+}
+
+func mergeVerification(runID string, into, r *Report) *Report {
+	if into == nil {
+		into = &Report{RunID: runID}
+	}
+	into.Acked += r.Acked
+	into.Aborted += r.Aborted
+	into.Leaked += r.Leaked
+	into.Delivered += r.Delivered
+	into.Missing += r.Missing
+	into.Duplicated += r.Duplicated
+	into.Unacked += r.Unacked
+	into.Waited = max(into.Waited, r.Waited)
+	for p, d := range r.Latency {
+		if into.Latency == nil {
+			into.Latency = make(map[string]time.Duration)
+		}
+		into.Latency[p] = max(into.Latency[p], d)
+	}
+	return into
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// Register joins the coordinated run at url as id and returns the
+// assignment once every instance has registered. It retries until ctx is
+// done, so generators may start before the coordinator.
+func Register(ctx context.Context, url, id string) (Assignment, error) {
+	body, err := json.Marshal(map[string]string{"id": id})
+	if err != nil {
+		return Assignment{}, err
+	}
+	endpoint := strings.TrimRight(url, "/") + "/register"
+	for {
+		var a Assignment
+		status, err := postJSON(ctx, endpoint, body, &a)
+		switch {
+		case err == nil && status == http.StatusOK:
+			return a, nil
+		case status == http.StatusConflict || status == http.StatusBadRequest:
+			return Assignment{}, fmt.Errorf("register with coordinator: %w", err)
+		case status != http.StatusServiceUnavailable:
+			slog.Warn("coordinator not reachable; retrying", "url", url, "error", err)
+		}
+		if err := sleep(ctx, time.Second); err != nil {
+			return Assignment{}, err
+		}
+	}
+}
+
+// SubmitReport sends report to the coordinator at url, retrying briefly.
+func SubmitReport(ctx context.Context, url string, report InstanceReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(url, "/") + "/report"
+	for attempt := 1; ; attempt++ {
+		status, err := postJSON(ctx, endpoint, body, nil)
+		if err == nil {
+			return nil
+		}
+		if attempt == 5 || (status >= 400 && status < 500) {
+			return fmt.Errorf("submit report: %w", err)
+		}
+		if err := sleep(ctx, time.Duration(attempt)*time.Second); err != nil {
+			return err
+		}
+	}
+}
+
+// postJSON posts body and decodes a 2xx response into out when it is not
+// nil. It returns the status code, or 0 if the request failed.
+func postJSON(ctx context.Context, endpoint string, body []byte, out any) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, registerPoll+10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return resp.StatusCode, errors.New(resp.Status + ": " + strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
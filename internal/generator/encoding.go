@@ -0,0 +1,134 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Payload encodings selected with GEN_PAYLOAD_ENCODING.
+const (
+	// EncodingJSON sends the template output or the default filler document.
+	EncodingJSON = "json"
+	// EncodingAvro sends Avro in the Confluent wire format.
+	EncodingAvro = "avro"
+	// EncodingProtobuf sends protobuf in the Confluent wire format.
+	EncodingProtobuf = "protobuf"
+)
+
+// Encoder turns a message into its wire payload. doc is the rendered payload
+// template, a JSON document, or nil to fill the schema with random values.
+// Encoders are not safe for concurrent use.
+type Encoder interface {
+	Encode(topic string, doc []byte) ([]byte, error)
+}
+
+// NewEncoder builds the encoder configured by cfg, registering schemas for
+// every destination topic. It returns nil for EncodingJSON.
+func NewEncoder(ctx context.Context, cfg Config, rng *rand.Rand) (Encoder, error) {
+	switch cfg.PayloadEncoding {
+	case EncodingJSON:
+		return nil, nil
+	case EncodingAvro:
+		return newAvroEncoder(ctx, cfg, rng)
+	case EncodingProtobuf:
+		return newProtobufEncoder(ctx, cfg, rng)
+	default:
+		return nil, fmt.Errorf("unsupported GEN_PAYLOAD_ENCODING %q", cfg.PayloadEncoding)
+	}
+}
+
+// confluentMagic starts every Confluent wire format payload, followed by the
+// big-endian schema id.
+const confluentMagic = 0
+
+func appendConfluentHeader(dst []byte, schemaID uint32) []byte {
+	dst = append(dst, confluentMagic)
+	return binary.BigEndian.AppendUint32(dst, schemaID)
+}
+
+// subject returns the registry subject for topic: GEN_SCHEMA_SUBJECT when
+// set, otherwise the TopicNameStrategy default "<topic>-value".
+func subject(cfg Config, topic string) string {
+	if cfg.SchemaSubject != "" {
+		return cfg.SchemaSubject
+	}
+	return topic + "-value"
+}
+
+// schemaReference points a schema at another registered subject, e.g. a
+// .proto file it imports.
+type schemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// registeredSchema is the part of a registry response the generator uses.
+type registeredSchema struct {
+	ID      uint32 `json:"id"`
+	Version int    `json:"version"`
+}
+
+// registerSchema registers schema under subject with a Confluent-compatible
+// schema registry and returns its id. Registering an identical schema again
+// returns the existing id.
+func registerSchema(ctx context.Context, registry, subject, schemaType, schema string, refs ...schemaReference) (uint32, error) {
+	out, err := postSchema(ctx, registry, "/subjects/"+url.PathEscape(subject)+"/versions", subject, schemaType, schema, refs)
+	return out.ID, err
+}
+
+// registerReference registers schema like registerSchema and returns the
+// subject version, which is what references to it name.
+func registerReference(ctx context.Context, registry, subject, schemaType, schema string, refs ...schemaReference) (int, error) {
+	if _, err := registerSchema(ctx, registry, subject, schemaType, schema, refs...); err != nil {
+		return 0, err
+	}
+	// Only the lookup endpoint reports the version.
+	out, err := postSchema(ctx, registry, "/subjects/"+url.PathEscape(subject), subject, schemaType, schema, refs)
+	return out.Version, err
+}
+
+func postSchema(ctx context.Context, registry, path, subject, schemaType, schema string, refs []schemaReference) (registeredSchema, error) {
+	body := map[string]any{"schema": schema}
+	if schemaType != "" {
+		body["schemaType"] = schemaType
+	}
+	if len(refs) > 0 {
+		body["references"] = refs
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return registeredSchema{}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	endpoint := strings.TrimRight(registry, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(raw))
+	if err != nil {
+		return registeredSchema{}, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return registeredSchema{}, fmt.Errorf("register schema for %s: %w", subject, err)
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return registeredSchema{}, fmt.Errorf("register schema for %s: %s: %s", subject, resp.Status, strings.TrimSpace(string(payload)))
+	}
+	var out registeredSchema
+	if err := json.Unmarshal(payload, &out); err != nil {
+		return registeredSchema{}, fmt.Errorf("register schema for %s: decode response: %w", subject, err)
+	}
+	return out, nil
+}
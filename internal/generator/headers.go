@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// HeaderSet renders the headers configured with GEN_HEADERS. Values
+// containing "{{" are templates with the same data and functions as payload
+// templates; other values are sent as is. It is not safe for concurrent use.
+type HeaderSet struct {
+	headers []headerSpec
+	buf     bytes.Buffer
+}
+
+type headerSpec struct {
+	key    []byte
+	static []byte
+	tmpl   *template.Template
+}
+
+// ParseHeaders parses semicolon-separated name=value pairs, e.g.
+// "content-type=application/json; trace-id={{uuid}}". rng drives the
+// template functions.
+func ParseHeaders(spec string, rng *rand.Rand) (*HeaderSet, error) {
+	set := &HeaderSet{}
+	funcs := templateFuncs(rng)
+	for _, raw := range strings.Split(spec, ";") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(raw, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("header %q: want name=value", raw)
+		}
+		h := headerSpec{key: []byte(name)}
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "{{") {
+			tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(value)
+			if err != nil {
+				return nil, fmt.Errorf("header %s: %w", name, err)
+			}
+			h.tmpl = tmpl
+		} else {
+			h.static = []byte(value)
+		}
+		set.headers = append(set.headers, h)
+	}
+	return set, nil
+}
+
+// Len returns the number of configured headers.
+func (s *HeaderSet) Len() int {
+	return len(s.headers)
+}
+
+// Render returns the headers for one message.
+func (s *HeaderSet) Render(seq int64, key, topic string) ([]Header, error) {
+	if len(s.headers) == 0 {
+		return nil, nil
+	}
+	data := PayloadData{Seq: seq, Key: key, Topic: topic, Now: time.Now().UTC()}
+	out := make([]Header, 0, len(s.headers))
+	for _, h := range s.headers {
+		if h.tmpl == nil {
+			out = append(out, Header{Key: h.key, Value: h.static})
+			continue
+		}
+		s.buf.Reset()
+		if err := h.tmpl.Execute(&s.buf, data); err != nil {
+			return nil, fmt.Errorf("render header %s: %w", h.key, err)
+		}
+		out = append(out, Header{Key: h.key, Value: bytes.Clone(s.buf.Bytes())})
+	}
+	return out, nil
+}
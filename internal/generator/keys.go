@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+// Key distribution modes selected with GEN_KEY_MODE.
+const (
+	// KeyModeUnique gives every message its own key: prefix-seq.
+	KeyModeUnique = "unique"
+	// KeyModeUniform picks uniformly from GEN_KEY_CARDINALITY keys.
+	KeyModeUniform = "uniform"
+	// KeyModeZipf picks from GEN_KEY_CARDINALITY keys with Zipf skew
+	// GEN_KEY_ZIPF_S, so a few hot keys carry most messages.
+	KeyModeZipf = "zipf"
+	// KeyModeTenant cycles through GEN_KEY_TENANTS tenant keys in order, so
+	// every tenant receives a strictly sequential stream.
+	KeyModeTenant = "tenant"
+	// KeyModeFile replays the keys listed in GEN_KEY_FILE, one per line,
+	// wrapping around at the end.
+	KeyModeFile = "file"
+)
+
+// KeySource yields the key for each message.
+type KeySource interface {
+	Next(seq int64) string
+}
+
+// NewKeySource builds the key source configured by cfg. rng must not be used
+// concurrently.
+//
+// In a coordinated run every instance owns the keys whose index modulo
+// cfg.Instances is cfg.Instance, and sees every cfg.Instances-th sequence
+// number, so instances never share a key.
+func NewKeySource(cfg Config, rng *rand.Rand) (KeySource, error) {
+	shard := keyShard{index: int64(cfg.Instance), count: int64(max(cfg.Instances, 1))}
+	owned := func(total int, name string) (int64, error) {
+		n := shard.size(int64(total))
+		if n < 1 {
+			return 0, fmt.Errorf("%s %d leaves instance %d of %d without keys", name, total, cfg.Instance, cfg.Instances)
+		}
+		return n, nil
+	}
+	switch cfg.KeyMode {
+	case KeyModeUnique:
+		return uniqueKeys{prefix: cfg.KeyPrefix}, nil
+	case KeyModeUniform:
+		n, err := owned(cfg.KeyCardinality, "GEN_KEY_CARDINALITY")
+		if err != nil {
+			return nil, err
+		}
+		return uniformKeys{prefix: cfg.KeyPrefix, n: n, shard: shard, rng: rng}, nil
+	case KeyModeZipf:
+		if cfg.KeyZipfS <= 1 {
+			return nil, fmt.Errorf("GEN_KEY_ZIPF_S must be > 1")
+		}
+		n, err := owned(cfg.KeyCardinality, "GEN_KEY_CARDINALITY")
+		if err != nil {
+			return nil, err
+		}
+		zipf := rand.NewZipf(rng, cfg.KeyZipfS, 1, uint64(n-1))
+		return zipfKeys{prefix: cfg.KeyPrefix, zipf: zipf, shard: shard}, nil
+	case KeyModeTenant:
+		n, err := owned(cfg.KeyTenants, "GEN_KEY_TENANTS")
+		if err != nil {
+			return nil, err
+		}
+		return tenantKeys{prefix: cfg.KeyPrefix, tenants: n, shard: shard}, nil
+	case KeyModeFile:
+		keys, err := readKeys(cfg.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		var mine []string
+		for i, key := range keys {
+			if int64(i)%shard.count == shard.index {
+				mine = append(mine, key)
+			}
+		}
+		if len(mine) == 0 {
+			return nil, fmt.Errorf("key file %s has %d keys, leaving instance %d of %d without keys", cfg.KeyFile, len(keys), cfg.Instance, cfg.Instances)
+		}
+		return fileKeys{keys: mine, shard: shard}, nil
+	default:
+		return nil, fmt.Errorf("unsupported GEN_KEY_MODE %q", cfg.KeyMode)
+	}
+}
+
+// keyShard is the slice of the key space an instance owns.
+type keyShard struct{ index, count int64 }
+
+// size is how many of total keys the shard owns.
+func (s keyShard) size(total int64) int64 {
+	return (total - s.index + s.count - 1) / s.count
+}
+
+// key maps the shard's i-th key to its index in the whole key space.
+func (s keyShard) key(i int64) int64 {
+	return i*s.count + s.index
+}
+
+// local maps a strided sequence number to 0, 1, 2, ... for this instance.
+func (s keyShard) local(seq int64) int64 {
+	return (seq - 1) / s.count
+}
+
+type uniqueKeys struct{ prefix string }
+
+func (k uniqueKeys) Next(seq int64) string {
+	return fmt.Sprintf("%s-%d", k.prefix, seq)
+}
+
+type uniformKeys struct {
+	prefix string
+	n      int64
+	shard  keyShard
+	rng    *rand.Rand
+}
+
+func (k uniformKeys) Next(int64) string {
+	return fmt.Sprintf("%s-%d", k.prefix, k.shard.key(k.rng.Int63n(k.n)))
+}
+
+type zipfKeys struct {
+	prefix string
+	zipf   *rand.Zipf
+	shard  keyShard
+}
+
+// Next maps rank 0, the hottest key, to prefix-0, or to prefix-<instance> in
+// a coordinated run.
+func (k zipfKeys) Next(int64) string {
+	return fmt.Sprintf("%s-%d", k.prefix, k.shard.key(int64(k.zipf.Uint64())))
+}
+
+type tenantKeys struct {
+	prefix  string
+	tenants int64
+	shard   keyShard
+}
+
+func (k tenantKeys) Next(seq int64) string {
+	return fmt.Sprintf("%s-tenant-%d", k.prefix, k.shard.key(k.shard.local(seq)%k.tenants))
+}
+
+type fileKeys struct {
+	keys  []string
+	shard keyShard
+}
+
+func (k fileKeys) Next(seq int64) string {
+	return k.keys[k.shard.local(seq)%int64(len(k.keys))]
+}
+
+func readKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open key file: %w", err)
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key file %s has no keys", path)
+	}
+	return keys, nil
+}
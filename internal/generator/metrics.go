@@ -0,0 +1,47 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Gauge is a value exported on the generator's /metrics endpoint.
+type Gauge struct {
+	Name string
+	Read func() float64
+}
+
+// ServeMetrics exposes gauges in Prometheus text format on addr until ctx is
+// done. It mirrors the worker's metrics server without its worker_* series.
+func ServeMetrics(ctx context.Context, addr string, gauges []Gauge) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		var b strings.Builder
+		for _, g := range gauges {
+			fmt.Fprintf(&b, "%s %g\n", g.Name, g.Read())
+		}
+		_, _ = w.Write([]byte(b.String()))
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Error("metrics server failed", "addr", addr, "error", err)
+	}
+}
@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// PayloadTemplate renders message values from a text/template so load looks
+// like real events. Templates see .Seq (message sequence number), .Key (the
+// message key), .Topic (the destination topic), .Now (render time, UTC) and
+// .Size (GEN_MESSAGE_SIZE), plus the functions listed in templateFuncs. It is
+// not safe for concurrent use.
+type PayloadTemplate struct {
+	tmpl *template.Template
+	size int
+	buf  bytes.Buffer
+}
+
+// PayloadData is the data passed to payload and header templates.
+type PayloadData struct {
+	Seq   int64
+	Key   string
+	Topic string
+	Now   time.Time
+	Size  int
+}
+
+// LoadPayloadTemplate parses the template at path. rng drives every random
+// function, so a seeded source gives reproducible payloads.
+func LoadPayloadTemplate(path string, rng *rand.Rand, size int) (*PayloadTemplate, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read payload template: %w", err)
+	}
+	p := &PayloadTemplate{size: size}
+	p.tmpl, err = template.New(filepath.Base(path)).Option("missingkey=error").Funcs(templateFuncs(rng)).Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parse payload template: %w", err)
+	}
+	return p, nil
+}
+
+// Render executes the template for one message. The returned slice is a copy
+// and stays valid after the next call.
+func (p *PayloadTemplate) Render(seq int64, key, topic string) ([]byte, error) {
+	p.buf.Reset()
+	data := PayloadData{Seq: seq, Key: key, Topic: topic, Now: time.Now().UTC(), Size: p.size}
+	if err := p.tmpl.Execute(&p.buf, data); err != nil {
+		return nil, fmt.Errorf("render payload: %w", err)
+	}
+	return bytes.Clone(p.buf.Bytes()), nil
+}
+
+// templateFuncs are the generators available to templates, all drawing from
+// rng:
+//
+//	uuid                         random version 4 UUID
+//	int MIN MAX                  integer in [MIN, MAX]
+//	float MIN MAX DECIMALS       number in [MIN, MAX) rounded to DECIMALS
+//	bool RATE                    true with probability RATE
+//	enum A B ...                 one of the values, uniformly
+//	weighted A WA B WB ...       one of the values, with integer weights
+//	text N                       N random alphanumeric characters
+//	timestamp                    render time, RFC 3339
+//	timeWithin DURATION          random time within DURATION before now, RFC 3339
+//	repeat N                     0..N-1, for building arrays with range
+//	json V                       V encoded as JSON, e.g. to quote a string
+func templateFuncs(rng *rand.Rand) template.FuncMap {
+	return template.FuncMap{
+		"uuid": func() string {
+			var b [16]byte
+			rng.Read(b[:])
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+		},
+		"int": func(min, max int) (int, error) {
+			if max < min {
+				return 0, fmt.Errorf("int: max %d < min %d", max, min)
+			}
+			return min + rng.Intn(max-min+1), nil
+		},
+		"float": func(min, max float64, decimals int) float64 {
+			scale := math.Pow(10, float64(decimals))
+			return math.Round((min+rng.Float64()*(max-min))*scale) / scale
+		},
+		"bool": func(rate float64) bool {
+			return rng.Float64() < rate
+		},
+		"enum": func(values ...any) (any, error) {
+			if len(values) == 0 {
+				return nil, fmt.Errorf("enum: no values")
+			}
+			return values[rng.Intn(len(values))], nil
+		},
+		"weighted": func(pairs ...any) (any, error) {
+			return weighted(rng, pairs)
+		},
+		"text": func(n int) string {
+			return randomText(rng, n)
+		},
+		"timestamp": func() string {
+			return time.Now().UTC().Format(time.RFC3339Nano)
+		},
+		"timeWithin": func(window string) (string, error) {
+			d, err := time.ParseDuration(window)
+			if err != nil || d <= 0 {
+				return "", fmt.Errorf("timeWithin: invalid duration %q", window)
+			}
+			return time.Now().UTC().Add(-time.Duration(rng.Int63n(int64(d)))).Format(time.RFC3339Nano), nil
+		},
+		"repeat": func(n int) []int {
+			out := make([]int, max(n, 0))
+			for i := range out {
+				out[i] = i
+			}
+			return out
+		},
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}
+}
+
+func weighted(rng *rand.Rand, pairs []any) (any, error) {
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("weighted: want value/weight pairs, got %d arguments", len(pairs))
+	}
+	weights := make([]int, len(pairs)/2)
+	total := 0
+	for i := range weights {
+		w, err := strconv.Atoi(fmt.Sprint(pairs[2*i+1]))
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("weighted: invalid weight %v", pairs[2*i+1])
+		}
+		weights[i] = w
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("weighted: weights sum to zero")
+	}
+	pick := rng.Intn(total)
+	for i, w := range weights {
+		if pick < w {
+			return pairs[2*i], nil
+		}
+		pick -= w
+	}
+	return pairs[len(pairs)-2], nil
+}
+
+// DefaultPayload is the JSON document sent without a payload template or
+// schema: the sequence number, a timestamp and random filler padding it to
+// size bytes.
+func DefaultPayload(r *rand.Rand, seq int64, size int) []byte {
+	doc := fmt.Sprintf(`{"id":%d,"ts":"%s","payload":"`, seq, time.Now().UTC().Format(time.RFC3339Nano))
+	const footer = `"}`
+	return []byte(doc + randomText(r, size-len(doc)-len(footer)) + footer)
+}
+
+func randomText(r *rand.Rand, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[r.Intn(len(alphabet))]
+	}
+	return string(b)
+}
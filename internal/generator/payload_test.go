@@ -0,0 +1,28 @@
+package generator
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestDefaultPayload(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 64, 1024} {
+		payload := DefaultPayload(rng, 42, size)
+		var doc struct {
+			ID      int64  `json:"id"`
+			TS      string `json:"ts"`
+			Payload string `json:"payload"`
+		}
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			t.Fatalf("size %d: %v: %s", size, err, payload)
+		}
+		if doc.ID != 42 || doc.TS == "" {
+			t.Errorf("size %d: have %+v", size, doc)
+		}
+		if size >= 64 && len(payload) != size {
+			t.Errorf("want %d bytes, have %d", size, len(payload))
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package generator
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protobufEncoder encodes one message type from a compiled descriptor set in
+// the Confluent wire format. Template documents use the protobuf JSON
+// mapping.
+type protobufEncoder struct {
+	desc protoreflect.MessageDescriptor
+	// prefixes holds each topic's Confluent header and message-index path.
+	prefixes map[string][]byte
+	rng      *rand.Rand
+}
+
+func newProtobufEncoder(ctx context.Context, cfg Config, rng *rand.Rand) (*protobufEncoder, error) {
+	raw, err := os.ReadFile(cfg.ProtoDescriptor)
+	if err != nil {
+		return nil, fmt.Errorf("read proto descriptor: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse proto descriptor: %w", err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("parse proto descriptor: %w", err)
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(cfg.ProtoMessage))
+	if err != nil {
+		return nil, fmt.Errorf("find proto message %s: %w", cfg.ProtoMessage, err)
+	}
+	desc, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", cfg.ProtoMessage)
+	}
+	e := &protobufEncoder{desc: desc, prefixes: make(map[string][]byte), rng: rng}
+
+	var source string
+	registry := &protoRegistry{url: cfg.SchemaRegistryURL, versions: make(map[string]int)}
+	bySubject := make(map[string]uint32)
+	for _, t := range cfg.Topics {
+		subj := subject(cfg, t.Name)
+		id, ok := bySubject[subj]
+		switch {
+		case ok:
+		case cfg.SchemaRegistryURL != "":
+			if source == "" {
+				if source, err = protoSource(desc.ParentFile()); err != nil {
+					return nil, fmt.Errorf("render proto schema: %w", err)
+				}
+			}
+			refs, err := registry.references(ctx, desc.ParentFile())
+			if err != nil {
+				return nil, err
+			}
+			if id, err = registerSchema(ctx, cfg.SchemaRegistryURL, subj, "PROTOBUF", source, refs...); err != nil {
+				return nil, err
+			}
+			slog.Info("registered protobuf schema", "subject", subj, "id", id)
+		default:
+			// Local stand-in for a registry, as for Avro.
+			id = uint32(max(cfg.SchemaID, 1))
+		}
+		bySubject[subj] = id
+		e.prefixes[t.Name] = appendMessageIndexes(appendConfluentHeader(nil, id), desc)
+	}
+	return e, nil
+}
+
+// protoRegistry registers the files a schema imports, so the schema can
+// reference them. Each file is registered once, under its import path.
+type protoRegistry struct {
+	url      string
+	versions map[string]int
+}
+
+func (r *protoRegistry) references(ctx context.Context, file protoreflect.FileDescriptor) ([]schemaReference, error) {
+	var refs []schemaReference
+	imports := file.Imports()
+	for i := 0; i < imports.Len(); i++ {
+		dep := imports.Get(i).FileDescriptor
+		path := dep.Path()
+		if strings.HasPrefix(path, "google/protobuf/") {
+			// Well-known types are built into the registry.
+			continue
+		}
+		version, ok := r.versions[path]
+		if !ok {
+			depRefs, err := r.references(ctx, dep)
+			if err != nil {
+				return nil, err
+			}
+			source, err := protoSource(dep)
+			if err != nil {
+				return nil, fmt.Errorf("render proto schema: %w", err)
+			}
+			if version, err = registerReference(ctx, r.url, path, "PROTOBUF", source, depRefs...); err != nil {
+				return nil, err
+			}
+			r.versions[path] = version
+		}
+		refs = append(refs, schemaReference{Name: path, Subject: path, Version: version})
+	}
+	return refs, nil
+}
+
+// appendMessageIndexes appends the Confluent message-index path of desc
+// within its file: a zigzag varint count followed by each index, shortened
+// to a single 0 for the first top-level message.
+func appendMessageIndexes(dst []byte, desc protoreflect.MessageDescriptor) []byte {
+	var path []int64
+	for d := protoreflect.Descriptor(desc); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		path = append([]int64{int64(d.Index())}, path...)
+	}
+	if len(path) == 1 && path[0] == 0 {
+		return append(dst, 0)
+	}
+	dst = binary.AppendVarint(dst, int64(len(path)))
+	for _, i := range path {
+		dst = binary.AppendVarint(dst, i)
+	}
+	return dst
+}
+
+func (e *protobufEncoder) Encode(topic string, doc []byte) ([]byte, error) {
+	msg := dynamicpb.NewMessage(e.desc)
+	if doc != nil {
+		if err := protojson.Unmarshal(doc, msg); err != nil {
+			return nil, fmt.Errorf("convert payload to protobuf: %w", err)
+		}
+	} else {
+		e.fill(msg, 0)
+	}
+	out, err := proto.MarshalOptions{}.MarshalAppend(append(make([]byte, 0, 256), e.prefixes[topic]...), msg)
+	if err != nil {
+		return nil, fmt.Errorf("encode protobuf: %w", err)
+	}
+	return out, nil
+}
+
+// fill sets every field of m to a random value, picking one field of each
+// oneof. Nested messages stop at maxRandomDepth.
+func (e *protobufEncoder) fill(m protoreflect.Message, depth int) {
+	md := m.Descriptor()
+	if md.FullName() == "google.protobuf.Timestamp" {
+		now := time.Now()
+		m.Set(md.Fields().ByName("seconds"), protoreflect.ValueOfInt64(now.Unix()))
+		m.Set(md.Fields().ByName("nanos"), protoreflect.ValueOfInt32(int32(now.Nanosecond())))
+		return
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			continue
+		}
+		e.fillField(m, fd, depth)
+	}
+	oneofs := md.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		oneof := oneofs.Get(i)
+		if oneof.IsSynthetic() {
+			continue
+		}
+		e.fillField(m, oneof.Fields().Get(e.rng.Intn(oneof.Fields().Len())), depth)
+	}
+}
+
+func (e *protobufEncoder) fillField(m protoreflect.Message, fd protoreflect.FieldDescriptor, depth int) {
+	switch {
+	case fd.IsList():
+		list := m.Mutable(fd).List()
+		for n := e.count(depth); n > 0; n-- {
+			list.Append(e.value(fd, list.NewElement, depth))
+		}
+	case fd.IsMap():
+		entries := m.Mutable(fd).Map()
+		for n := e.count(depth); n > 0; n-- {
+			key := e.scalar(fd.MapKey()).MapKey()
+			entries.Set(key, e.value(fd.MapValue(), entries.NewValue, depth))
+		}
+	case fd.Message() != nil:
+		if depth < maxRandomDepth {
+			e.fill(m.Mutable(fd).Message(), depth+1)
+		}
+	default:
+		m.Set(fd, e.scalar(fd))
+	}
+}
+
+// value returns a random list element or map value; newMessage allocates
+// one when fd is a message.
+func (e *protobufEncoder) value(fd protoreflect.FieldDescriptor, newMessage func() protoreflect.Value, depth int) protoreflect.Value {
+	if fd.Message() == nil {
+		return e.scalar(fd)
+	}
+	v := newMessage()
+	e.fill(v.Message(), depth+1)
+	return v
+}
+
+func (e *protobufEncoder) count(depth int) int {
+	if depth >= maxRandomDepth {
+		return 0
+	}
+	return e.rng.Intn(4)
+}
+
+func (e *protobufEncoder) scalar(fd protoreflect.FieldDescriptor) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(e.rng.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(e.rng.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(e.rng.Intn(1000)))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(e.rng.Int63n(1_000_000))
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(e.rng.Intn(1000)))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(e.rng.Int63n(1_000_000)))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(e.rng.Float32() * 1000)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(e.rng.Float64() * 1000)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(randomText(e.rng, 8+e.rng.Intn(9)))
+	case protoreflect.BytesKind:
+		b := make([]byte, 8)
+		e.rng.Read(b)
+		return protoreflect.ValueOfBytes(b)
+	default:
+		return fd.Default()
+	}
+}
@@ -0,0 +1,297 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// protoSource renders file as .proto source, which is what schema registries
+// store; a descriptor set does not carry it. It covers everything that
+// affects the wire format and JSON mapping: messages, enums, oneofs, maps,
+// defaults, reserved and extension ranges, extensions and services. Other
+// options are left out. Type names are written fully qualified.
+func protoSource(file protoreflect.FileDescriptor) (string, error) {
+	fd := protodesc.ToFileDescriptorProto(file)
+	syntax := fd.GetSyntax()
+	if syntax == "" {
+		syntax = "proto2"
+	}
+	if syntax != "proto2" && syntax != "proto3" {
+		return "", fmt.Errorf("%s: syntax %q is not supported", fd.GetName(), syntax)
+	}
+	p := &protoPrinter{proto3: syntax == "proto3"}
+	p.line(0, "syntax = %q;", syntax)
+	if fd.Package != nil {
+		p.line(0, "package %s;", fd.GetPackage())
+	}
+	public, weak := make(map[int]bool), make(map[int]bool)
+	for _, i := range fd.PublicDependency {
+		public[int(i)] = true
+	}
+	for _, i := range fd.WeakDependency {
+		weak[int(i)] = true
+	}
+	for i, dep := range fd.Dependency {
+		switch {
+		case public[i]:
+			p.line(0, "import public %q;", dep)
+		case weak[i]:
+			p.line(0, "import weak %q;", dep)
+		default:
+			p.line(0, "import %q;", dep)
+		}
+	}
+	for _, m := range fd.MessageType {
+		p.message(0, m)
+	}
+	for _, e := range fd.EnumType {
+		p.enum(0, e)
+	}
+	p.extensions(0, fd.Extension)
+	for _, s := range fd.Service {
+		p.line(0, "service %s {", s.GetName())
+		for _, m := range s.Method {
+			p.line(1, "rpc %s(%s%s) returns (%s%s);", m.GetName(),
+				streamPrefix(m.GetClientStreaming()), m.GetInputType(),
+				streamPrefix(m.GetServerStreaming()), m.GetOutputType())
+		}
+		p.line(0, "}")
+	}
+	return p.b.String(), p.err
+}
+
+type protoPrinter struct {
+	b      strings.Builder
+	proto3 bool
+	err    error
+}
+
+func (p *protoPrinter) line(depth int, format string, args ...any) {
+	p.b.WriteString(strings.Repeat("  ", depth))
+	fmt.Fprintf(&p.b, format, args...)
+	p.b.WriteByte('\n')
+}
+
+func (p *protoPrinter) message(depth int, m *descriptorpb.DescriptorProto) {
+	p.line(depth, "message %s {", m.GetName())
+	printed := make(map[int32]bool)
+	for _, f := range m.Field {
+		if f.OneofIndex == nil || f.GetProto3Optional() {
+			p.field(depth+1, m, f, true)
+			continue
+		}
+		index := f.GetOneofIndex()
+		if printed[index] {
+			continue
+		}
+		printed[index] = true
+		p.line(depth+1, "oneof %s {", m.OneofDecl[index].GetName())
+		for _, member := range m.Field {
+			if member.OneofIndex != nil && member.GetOneofIndex() == index {
+				p.field(depth+2, m, member, false)
+			}
+		}
+		p.line(depth+1, "}")
+	}
+	for _, nested := range m.NestedType {
+		if !nested.GetOptions().GetMapEntry() {
+			p.message(depth+1, nested)
+		}
+	}
+	for _, e := range m.EnumType {
+		p.enum(depth+1, e)
+	}
+	for _, r := range m.ExtensionRange {
+		p.line(depth+1, "extensions %s;", rangeText(r.GetStart(), r.GetEnd()-1, maxFieldNumber))
+	}
+	for _, r := range m.ReservedRange {
+		p.line(depth+1, "reserved %s;", rangeText(r.GetStart(), r.GetEnd()-1, maxFieldNumber))
+	}
+	if len(m.ReservedName) > 0 {
+		p.line(depth+1, "reserved %s;", quoteAll(m.ReservedName))
+	}
+	p.extensions(depth+1, m.Extension)
+	p.line(depth, "}")
+}
+
+// field prints f of message m. labeled is false inside a oneof, where fields
+// take no label.
+func (p *protoPrinter) field(depth int, m *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto, labeled bool) {
+	if f.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+		p.fail(fmt.Errorf("field %s: groups are not supported", f.GetName()))
+		return
+	}
+	typ := fieldType(f)
+	if entry := mapEntry(m, f); entry != nil {
+		typ = fmt.Sprintf("map<%s, %s>", fieldType(entry.Field[0]), fieldType(entry.Field[1]))
+	} else if labeled {
+		typ = p.label(f) + typ
+	}
+	p.line(depth, "%s %s = %d%s;", typ, f.GetName(), f.GetNumber(), fieldOptions(f))
+}
+
+func (p *protoPrinter) label(f *descriptorpb.FieldDescriptorProto) string {
+	switch f.GetLabel() {
+	case descriptorpb.FieldDescriptorProto_LABEL_REPEATED:
+		return "repeated "
+	case descriptorpb.FieldDescriptorProto_LABEL_REQUIRED:
+		return "required "
+	}
+	if !p.proto3 || f.GetProto3Optional() {
+		return "optional "
+	}
+	return ""
+}
+
+// extensions prints extension fields grouped by the message they extend.
+func (p *protoPrinter) extensions(depth int, fields []*descriptorpb.FieldDescriptorProto) {
+	var extendees []string
+	byExtendee := make(map[string][]*descriptorpb.FieldDescriptorProto)
+	for _, f := range fields {
+		if _, ok := byExtendee[f.GetExtendee()]; !ok {
+			extendees = append(extendees, f.GetExtendee())
+		}
+		byExtendee[f.GetExtendee()] = append(byExtendee[f.GetExtendee()], f)
+	}
+	for _, extendee := range extendees {
+		p.line(depth, "extend %s {", extendee)
+		for _, f := range byExtendee[extendee] {
+			p.field(depth+1, nil, f, true)
+		}
+		p.line(depth, "}")
+	}
+}
+
+func (p *protoPrinter) enum(depth int, e *descriptorpb.EnumDescriptorProto) {
+	p.line(depth, "enum %s {", e.GetName())
+	if e.GetOptions().GetAllowAlias() {
+		p.line(depth+1, "option allow_alias = true;")
+	}
+	for _, v := range e.Value {
+		var opts string
+		if v.GetOptions().GetDeprecated() {
+			opts = " [deprecated = true]"
+		}
+		p.line(depth+1, "%s = %d%s;", v.GetName(), v.GetNumber(), opts)
+	}
+	for _, r := range e.ReservedRange {
+		// Enum reserved ranges are inclusive, unlike message ones.
+		p.line(depth+1, "reserved %s;", rangeText(r.GetStart(), r.GetEnd(), math.MaxInt32))
+	}
+	if len(e.ReservedName) > 0 {
+		p.line(depth+1, "reserved %s;", quoteAll(e.ReservedName))
+	}
+	p.line(depth, "}")
+}
+
+func (p *protoPrinter) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// mapEntry returns the synthesized entry message when f is a map field.
+func mapEntry(m *descriptorpb.DescriptorProto, f *descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	if m == nil || f.GetType() != descriptorpb.FieldDescriptorProto_TYPE_MESSAGE ||
+		f.GetLabel() != descriptorpb.FieldDescriptorProto_LABEL_REPEATED {
+		return nil
+	}
+	name := f.GetTypeName()[strings.LastIndex(f.GetTypeName(), ".")+1:]
+	for _, nested := range m.NestedType {
+		if nested.GetName() == name && nested.GetOptions().GetMapEntry() {
+			return nested
+		}
+	}
+	return nil
+}
+
+func fieldType(f *descriptorpb.FieldDescriptorProto) string {
+	switch f.GetType() {
+	case descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, descriptorpb.FieldDescriptorProto_TYPE_ENUM:
+		return f.GetTypeName()
+	default:
+		return strings.ToLower(strings.TrimPrefix(f.GetType().String(), "TYPE_"))
+	}
+}
+
+func fieldOptions(f *descriptorpb.FieldDescriptorProto) string {
+	var opts []string
+	if f.DefaultValue != nil {
+		value := f.GetDefaultValue()
+		switch f.GetType() {
+		case descriptorpb.FieldDescriptorProto_TYPE_STRING:
+			value = strconv.Quote(value)
+		case descriptorpb.FieldDescriptorProto_TYPE_BYTES:
+			// Already C-escaped in the descriptor.
+			value = `"` + value + `"`
+		}
+		opts = append(opts, "default = "+value)
+	}
+	if f.JsonName != nil && f.GetJsonName() != jsonCamelCase(f.GetName()) {
+		opts = append(opts, fmt.Sprintf("json_name = %q", f.GetJsonName()))
+	}
+	if f.GetOptions() != nil && f.GetOptions().Packed != nil {
+		opts = append(opts, fmt.Sprintf("packed = %t", f.GetOptions().GetPacked()))
+	}
+	if f.GetOptions().GetDeprecated() {
+		opts = append(opts, "deprecated = true")
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(opts, ", ") + "]"
+}
+
+// jsonCamelCase is protoc's default json_name for a field.
+func jsonCamelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// maxFieldNumber is the largest field number.
+const maxFieldNumber = 1<<29 - 1
+
+// rangeText renders an inclusive range, writing limit as max.
+func rangeText(start, end, limit int32) string {
+	switch {
+	case end >= limit:
+		return fmt.Sprintf("%d to max", start)
+	case start == end:
+		return strconv.Itoa(int(start))
+	default:
+		return fmt.Sprintf("%d to %d", start, end)
+	}
+}
+
+func quoteAll(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func streamPrefix(stream bool) string {
+	if stream {
+		return "stream "
+	}
+	return ""
+}
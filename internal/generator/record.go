@@ -0,0 +1,303 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+	"unicode/utf8"
+)
+
+// Capture file formats selected with GEN_CAPTURE_FORMAT.
+const (
+	// FormatNDJSON stores one JSON object per line:
+	//
+	//	{"rel_ms":12,"key":"k","value":"{...}","headers":[{"key":"h","value":"v"}]}
+	//
+	// Keys and values that are not valid UTF-8 are written as key_b64 and
+	// value_b64 instead. rel_ms is optional.
+	FormatNDJSON = "ndjson"
+	// FormatLengthPrefixed stores each record as a big-endian uint32 length
+	// followed by: int64 rel_ms (-1 when untimed), key, value, a uint32 header
+	// count and each header's key and value. Every byte field is an int32
+	// length (-1 for null) and the bytes.
+	FormatLengthPrefixed = "length-prefixed"
+)
+
+// Header is a Kafka record header.
+type Header struct {
+	Key   []byte
+	Value []byte
+}
+
+// Record is one captured message.
+type Record struct {
+	// At is the record's time relative to the start of the capture; only
+	// meaningful when Timed is set.
+	At      time.Duration
+	Timed   bool
+	Key     []byte
+	Value   []byte
+	Headers []Header
+}
+
+// RecordReader reads records until io.EOF.
+type RecordReader interface {
+	Read() (Record, error)
+}
+
+// RecordWriter writes records; Flush must be called before the underlying
+// writer is closed.
+type RecordWriter interface {
+	Write(Record) error
+	Flush() error
+}
+
+// NewRecordReader reads records in format from r.
+func NewRecordReader(r io.Reader, format string) (RecordReader, error) {
+	switch format {
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+		return &ndjsonReader{scanner: scanner}, nil
+	case FormatLengthPrefixed:
+		return &binaryReader{r: bufio.NewReader(r)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported capture format %q", format)
+	}
+}
+
+// NewRecordWriter writes records in format to w.
+func NewRecordWriter(w io.Writer, format string) (RecordWriter, error) {
+	switch format {
+	case FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}, nil
+	case FormatLengthPrefixed:
+		return &binaryWriter{buf: bufio.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported capture format %q", format)
+	}
+}
+
+// maxRecordSize bounds a single record so a corrupt length cannot allocate
+// unbounded memory.
+const maxRecordSize = 64 << 20
+
+type jsonRecord struct {
+	RelMS    *int64       `json:"rel_ms,omitempty"`
+	Key      *string      `json:"key,omitempty"`
+	KeyB64   []byte       `json:"key_b64,omitempty"`
+	Value    *string      `json:"value,omitempty"`
+	ValueB64 []byte       `json:"value_b64,omitempty"`
+	Headers  []jsonHeader `json:"headers,omitempty"`
+}
+
+type jsonHeader struct {
+	Key      string  `json:"key"`
+	Value    *string `json:"value,omitempty"`
+	ValueB64 []byte  `json:"value_b64,omitempty"`
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *ndjsonReader) Read() (Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+		raw := r.scanner.Bytes()
+		if len(raw) == 0 {
+			continue
+		}
+		var jr jsonRecord
+		if err := json.Unmarshal(raw, &jr); err != nil {
+			return Record{}, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		rec := Record{
+			Key:   textOrBytes(jr.Key, jr.KeyB64),
+			Value: textOrBytes(jr.Value, jr.ValueB64),
+		}
+		if jr.RelMS != nil {
+			rec.At, rec.Timed = time.Duration(*jr.RelMS)*time.Millisecond, true
+		}
+		for _, h := range jr.Headers {
+			rec.Headers = append(rec.Headers, Header{Key: []byte(h.Key), Value: textOrBytes(h.Value, h.ValueB64)})
+		}
+		return rec, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return Record{}, fmt.Errorf("line %d: %w", r.line+1, err)
+	}
+	return Record{}, io.EOF
+}
+
+func textOrBytes(text *string, raw []byte) []byte {
+	if text != nil {
+		return []byte(*text)
+	}
+	return raw
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(rec Record) error {
+	var jr jsonRecord
+	if rec.Timed {
+		ms := rec.At.Milliseconds()
+		jr.RelMS = &ms
+	}
+	jr.Key, jr.KeyB64 = splitText(rec.Key)
+	jr.Value, jr.ValueB64 = splitText(rec.Value)
+	for _, h := range rec.Headers {
+		jh := jsonHeader{Key: string(h.Key)}
+		jh.Value, jh.ValueB64 = splitText(h.Value)
+		jr.Headers = append(jr.Headers, jh)
+	}
+	return w.enc.Encode(jr)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+// splitText keeps readable bytes as a string and everything else as base64.
+func splitText(b []byte) (*string, []byte) {
+	if b == nil {
+		return nil, nil
+	}
+	if utf8.Valid(b) {
+		s := string(b)
+		return &s, nil
+	}
+	return nil, b
+}
+
+type binaryReader struct {
+	r *bufio.Reader
+}
+
+func (r *binaryReader) Read() (Record, error) {
+	var size uint32
+	if err := binary.Read(r.r, binary.BigEndian, &size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("read record length: %w", err)
+	}
+	if size > maxRecordSize {
+		return Record{}, fmt.Errorf("record length %d exceeds %d bytes", size, maxRecordSize)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r.r, body); err != nil {
+		return Record{}, fmt.Errorf("read record: %w", err)
+	}
+
+	d := decoder{buf: body}
+	var rec Record
+	if rel := int64(d.uint64()); rel >= 0 {
+		rec.At, rec.Timed = time.Duration(rel)*time.Millisecond, true
+	}
+	rec.Key = d.bytes()
+	rec.Value = d.bytes()
+	for n := d.uint32(); n > 0 && d.err == nil; n-- {
+		rec.Headers = append(rec.Headers, Header{Key: d.bytes(), Value: d.bytes()})
+	}
+	if d.err != nil {
+		return Record{}, d.err
+	}
+	return rec, nil
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.buf) {
+		d.err = fmt.Errorf("truncated record")
+		return nil
+	}
+	out := d.buf[:n]
+	d.buf = d.buf[n:]
+	return out
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := int32(d.uint32())
+	if n < 0 || d.err != nil {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+type binaryWriter struct {
+	buf     *bufio.Writer
+	scratch []byte
+}
+
+func (w *binaryWriter) Write(rec Record) error {
+	body := w.scratch[:0]
+	rel := int64(-1)
+	if rec.Timed {
+		rel = rec.At.Milliseconds()
+	}
+	body = binary.BigEndian.AppendUint64(body, uint64(rel))
+	body = appendBytes(body, rec.Key)
+	body = appendBytes(body, rec.Value)
+	body = binary.BigEndian.AppendUint32(body, uint32(len(rec.Headers)))
+	for _, h := range rec.Headers {
+		body = appendBytes(body, h.Key)
+		body = appendBytes(body, h.Value)
+	}
+	w.scratch = body
+	if len(body) > maxRecordSize {
+		return fmt.Errorf("record length %d exceeds %d bytes", len(body), maxRecordSize)
+	}
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(body)))
+	if _, err := w.buf.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := w.buf.Write(body)
+	return err
+}
+
+func (w *binaryWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func appendBytes(dst, b []byte) []byte {
+	if b == nil {
+		return binary.BigEndian.AppendUint32(dst, math.MaxUint32)
+	}
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(b)))
+	return append(dst, b...)
+}
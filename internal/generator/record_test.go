@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordFormatsRoundTrip(t *testing.T) {
+	records := []Record{
+		{At: 0, Timed: true, Key: []byte("k1"), Value: []byte(`{"id":1}`)},
+		{At: 1250 * time.Millisecond, Timed: true, Key: nil, Value: []byte{0xff, 0x00, 0xfe},
+			Headers: []Header{{Key: []byte("trace"), Value: []byte("abc")}, {Key: []byte("bin"), Value: []byte{0xc3, 0x28}}}},
+		{Key: []byte(""), Value: nil, Headers: []Header{{Key: []byte("empty"), Value: nil}}},
+	}
+	for _, format := range []string{FormatNDJSON, FormatLengthPrefixed} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewRecordWriter(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, rec := range records {
+				if err := w.Write(rec); err != nil {
+					t.Fatalf("write: %v", err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewRecordReader(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range records {
+				got, err := r.Read()
+				if err != nil {
+					t.Fatalf("record %d: %v", i, err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("record %d:\nwant %+v\nhave %+v", i, want, got)
+				}
+			}
+			if _, err := r.Read(); !errors.Is(err, io.EOF) {
+				t.Errorf("want io.EOF after the last record, have %v", err)
+			}
+		})
+	}
+}
+
+func TestNDJSONReaderAcceptsHandWrittenLines(t *testing.T) {
+	input := `{"key":"a","value":"1"}
+
+{"rel_ms":5,"value_b64":"/w=="}
+`
+	r, _ := NewRecordReader(strings.NewReader(input), FormatNDJSON)
+	first, err := r.Read()
+	if err != nil || first.Timed || string(first.Key) != "a" || string(first.Value) != "1" {
+		t.Fatalf("first record: have %+v, %v", first, err)
+	}
+	second, err := r.Read()
+	if err != nil || !second.Timed || second.At != 5*time.Millisecond || !bytes.Equal(second.Value, []byte{0xff}) {
+		t.Fatalf("second record: have %+v, %v", second, err)
+	}
+
+	r, _ = NewRecordReader(strings.NewReader("{\"key\":\"a\"}\nnot json\n"), FormatNDJSON)
+	r.Read()
+	if _, err := r.Read(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("want an error naming line 2, have %v", err)
+	}
+}
+
+func TestBinaryReaderRejectsCorruptInput(t *testing.T) {
+	length := func(n uint32) []byte { return binary.BigEndian.AppendUint32(nil, n) }
+	for _, tc := range []struct {
+		name  string
+		input []byte
+	}{
+		{"oversized length", length(maxRecordSize + 1)},
+		{"short body", append(length(16), 0, 0, 0)},
+		{"truncated field", append(length(12), append(make([]byte, 8), 0, 0, 0, 9)...)},
+		{"partial length", []byte{0, 0}},
+	} {
+		r, _ := NewRecordReader(bytes.NewReader(tc.input), FormatLengthPrefixed)
+		if _, err := r.Read(); err == nil || errors.Is(err, io.EOF) {
+			t.Errorf("%s: want a decode error, have %v", tc.name, err)
+		}
+	}
+}
+
+func TestUnknownRecordFormat(t *testing.T) {
+	if _, err := NewRecordReader(strings.NewReader(""), "csv"); err == nil {
+		t.Error("want error for reader format csv")
+	}
+	if _, err := NewRecordWriter(io.Discard, "csv"); err == nil {
+		t.Error("want error for writer format csv")
+	}
+}
@@ -0,0 +1,41 @@
+package generator
+
+import (
+	"context"
+	"time"
+)
+
+// Replayer reads captured records and releases each one at its recorded time,
+// scaled by speed. A speed of 0 replays as fast as possible, as does any
+// record without a timestamp.
+type Replayer struct {
+	reader RecordReader
+	speed  float64
+
+	started time.Time
+	first   time.Duration
+	timed   bool
+}
+
+// NewReplayer starts the replay clock at the first timed record.
+func NewReplayer(reader RecordReader, speed float64) *Replayer {
+	return &Replayer{reader: reader, speed: speed}
+}
+
+// Next returns the next record once it is due, or io.EOF at the end of the
+// capture.
+func (r *Replayer) Next(ctx context.Context) (Record, error) {
+	rec, err := r.reader.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	if r.speed <= 0 || !rec.Timed {
+		return rec, ctx.Err()
+	}
+	if !r.timed {
+		r.started, r.first, r.timed = time.Now(), rec.At, true
+		return rec, ctx.Err()
+	}
+	due := r.started.Add(time.Duration(float64(rec.At-r.first) / r.speed))
+	return rec, sleep(ctx, time.Until(due))
+}
@@ -0,0 +1,395 @@
+package generator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"demo/internal/redact"
+)
+
+// Run report formats selected with GEN_REPORT_FORMAT.
+const (
+	ReportJSON = "json"
+	ReportCSV  = "csv"
+)
+
+// RunReport is the machine-readable summary of one generator run.
+type RunReport struct {
+	RunID    string    `json:"run_id"`
+	Mode     string    `json:"mode"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Seconds  float64   `json:"seconds"`
+	Produced int64     `json:"produced"`
+	Acked    int64     `json:"acked"`
+	Errors   int64     `json:"errors"`
+	// ErrorsByType counts produce errors by Kafka error, sarama error name or
+	// Go error type.
+	ErrorsByType map[string]int64 `json:"errors_by_type"`
+	// AckLatencyMS holds percentiles of the time from handing a message to
+	// the producer until the broker acknowledged it, in milliseconds.
+	AckLatencyMS map[string]float64 `json:"ack_latency_ms"`
+	PerSecond    []SecondStats      `json:"per_second"`
+	Config       map[string]string  `json:"config"`
+	Verification *Report            `json:"verification,omitempty"`
+	// Instances lists each generator of a coordinated run.
+	Instances []InstanceSummary `json:"instances,omitempty"`
+}
+
+// SecondStats counts what happened in one second of the run, by when it
+// happened rather than when the message was produced.
+type SecondStats struct {
+	Second   int   `json:"second"`
+	Produced int64 `json:"produced"`
+	Acked    int64 `json:"acked"`
+	Errors   int64 `json:"errors"`
+}
+
+// Recorder collects run statistics. It is safe for concurrent use, since
+// produce, acknowledgement and error events arrive on different goroutines.
+type Recorder struct {
+	started time.Time
+
+	mu       sync.Mutex
+	seconds  []SecondStats
+	errors   map[string]int64
+	produced int64
+	acked    int64
+	failed   int64
+	latency  latencyHistogram
+}
+
+// NewRecorder starts the run clock.
+func NewRecorder() *Recorder {
+	return &Recorder{started: time.Now(), errors: make(map[string]int64)}
+}
+
+func (r *Recorder) second(now time.Time) *SecondStats {
+	s := int(now.Sub(r.started) / time.Second)
+	for len(r.seconds) <= s {
+		r.seconds = append(r.seconds, SecondStats{Second: len(r.seconds)})
+	}
+	return &r.seconds[s]
+}
+
+// Produced records a message handed to the producer.
+func (r *Recorder) Produced() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.produced++
+	r.second(time.Now()).Produced++
+}
+
+// Acked records an acknowledgement for a message handed over at sent.
+func (r *Recorder) Acked(sent time.Time) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acked++
+	r.second(now).Acked++
+	if !sent.IsZero() {
+		r.latency.observe(now.Sub(sent))
+	}
+}
+
+// Failed records a produce error.
+func (r *Recorder) Failed(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed++
+	r.second(time.Now()).Errors++
+	r.errors[errorType(err)]++
+}
+
+// producerErrors are the sarama client errors a produce can fail with.
+var producerErrors = []struct {
+	err  error
+	name string
+}{
+	{sarama.ErrOutOfBrokers, "ErrOutOfBrokers"},
+	{sarama.ErrBrokerNotFound, "ErrBrokerNotFound"},
+	{sarama.ErrNotConnected, "ErrNotConnected"},
+	{sarama.ErrClosedClient, "ErrClosedClient"},
+	{sarama.ErrShuttingDown, "ErrShuttingDown"},
+	{sarama.ErrControllerNotAvailable, "ErrControllerNotAvailable"},
+	{sarama.ErrIncompleteResponse, "ErrIncompleteResponse"},
+	{sarama.ErrInvalidPartition, "ErrInvalidPartition"},
+	{sarama.ErrAddPartitionsToTxn, "ErrAddPartitionsToTxn"},
+	{sarama.ErrTxnOffsetCommit, "ErrTxnOffsetCommit"},
+	{sarama.ErrTransactionNotReady, "ErrTransactionNotReady"},
+	{sarama.ErrNonTransactedProducer, "ErrNonTransactedProducer"},
+	{sarama.ErrTransitionNotAllowed, "ErrTransitionNotAllowed"},
+	{sarama.ErrCannotTransitionNilError, "ErrCannotTransitionNilError"},
+	{sarama.ErrTxnUnableToParseResponse, "ErrTxnUnableToParseResponse"},
+}
+
+// errorType names err for the breakdown: the Kafka error code when there is
+// one, then the sarama error or a network timeout, then the type of the
+// innermost typed error. Plain errors count as "other"; messages would make
+// the set of keys unbounded.
+func errorType(err error) string {
+	var kerr sarama.KError
+	if errors.As(err, &kerr) {
+		return kerr.Error()
+	}
+	for _, known := range producerErrors {
+		if errors.Is(err, known.err) {
+			return known.name
+		}
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return "timeout"
+	}
+	name := "other"
+	for ; err != nil; err = errors.Unwrap(err) {
+		if typ := fmt.Sprintf("%T", err); !plainErrors[typ] {
+			name = typ
+		}
+	}
+	return name
+}
+
+// plainErrors are error types that say nothing about the kind of failure:
+// messages, wrappers, and the envelope every produce error arrives in.
+var plainErrors = map[string]bool{
+	"*errors.errorString":   true,
+	"*fmt.wrapError":        true,
+	"*fmt.wrapErrors":       true,
+	"*sarama.ProducerError": true,
+}
+
+// Report snapshots the statistics for cfg's run.
+func (r *Recorder) Report(runID string, cfg Config) RunReport {
+	finished := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := RunReport{
+		RunID:        runID,
+		Mode:         cfg.Mode,
+		Started:      r.started.UTC(),
+		Finished:     finished.UTC(),
+		Seconds:      math.Round(finished.Sub(r.started).Seconds()*1000) / 1000,
+		Produced:     r.produced,
+		Acked:        r.acked,
+		Errors:       r.failed,
+		ErrorsByType: make(map[string]int64, len(r.errors)),
+		AckLatencyMS: r.latency.percentiles(),
+		PerSecond:    append([]SecondStats(nil), r.seconds...),
+		Config:       cfg.Settings(),
+	}
+	for k, v := range r.errors {
+		report.ErrorsByType[k] = v
+	}
+	return report
+}
+
+// latencyHistogram buckets durations logarithmically, each bucket 2% wider
+// than the last, so percentiles stay within about 1% without keeping every
+// sample.
+type latencyHistogram struct {
+	buckets map[int]int64
+	count   int64
+	max     time.Duration
+}
+
+const latencyGrowth = 1.02
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if h.buckets == nil {
+		h.buckets = make(map[int]int64)
+	}
+	us := math.Max(1, float64(d.Microseconds()))
+	h.buckets[int(math.Log(us)/math.Log(latencyGrowth))]++
+	h.count++
+	h.max = max(h.max, d)
+}
+
+// percentiles returns p50, p90, p99, p99.9 and max in milliseconds, using
+// each bucket's midpoint.
+func (h *latencyHistogram) percentiles() map[string]float64 {
+	if h.count == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(h.buckets))
+	for i := range h.buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	at := func(p float64) float64 {
+		rank := int64(math.Ceil(p * float64(h.count)))
+		var seen int64
+		for _, i := range indexes {
+			seen += h.buckets[i]
+			if seen >= rank {
+				mid := math.Pow(latencyGrowth, float64(i)+0.5)
+				return math.Round(mid) / 1000
+			}
+		}
+		return float64(h.max.Microseconds()) / 1000
+	}
+	return map[string]float64{
+		"p50":   at(0.50),
+		"p90":   at(0.90),
+		"p99":   at(0.99),
+		"p99.9": at(0.999),
+		"max":   float64(h.max.Microseconds()) / 1000,
+	}
+}
+
+// Settings flattens the configuration for the report, with passwords in the
+// database and service URLs masked.
+func (c Config) Settings() map[string]string {
+	out := make(map[string]string)
+	v := reflect.ValueOf(c)
+	for i := 0; i < v.NumField(); i++ {
+		name, field := v.Type().Field(i).Name, v.Field(i)
+		switch value := field.Interface().(type) {
+		case []Phase:
+			parts := make([]string, len(value))
+			for j, p := range value {
+				parts[j] = p.String()
+			}
+			out[name] = strings.Join(parts, "; ")
+		case []WeightedTopic:
+			parts := make([]string, len(value))
+			for j, t := range value {
+				parts[j] = t.Name + ":" + strconv.Itoa(t.Weight)
+			}
+			out[name] = strings.Join(parts, ",")
+		case []string:
+			out[name] = strings.Join(value, ",")
+		case []int32:
+			parts := make([]string, len(value))
+			for j, p := range value {
+				parts[j] = strconv.Itoa(int(p))
+			}
+			out[name] = strings.Join(parts, ",")
+		default:
+			out[name] = fmt.Sprint(value)
+		}
+	}
+	out["VerifyDSN"] = redact.DSN(c.VerifyDSN)
+	out["SchemaRegistryURL"] = redact.DSN(c.SchemaRegistryURL)
+	out["CoordinatorURL"] = redact.DSN(c.CoordinatorURL)
+	return out
+}
+
+// ReportFormat returns the explicit format, or the one implied by path's
+// extension.
+func ReportFormat(path, format string) string {
+	if format != "" {
+		return format
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReportCSV
+	}
+	return ReportJSON
+}
+
+// WriteReport writes report to path in format.
+func WriteReport(path, format string, report RunReport) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create report: %w", err)
+	}
+	switch format {
+	case ReportJSON:
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	case ReportCSV:
+		err = writeReportCSV(f, report)
+	default:
+		err = fmt.Errorf("unsupported report format %q", format)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	return nil
+}
+
+// writeReportCSV writes the report as section,key,metric,value rows, sorted
+// within each section so two runs diff line by line.
+func writeReportCSV(w io.Writer, r RunReport) error {
+	cw := csv.NewWriter(w)
+	row := func(section, key, metric string, value any) {
+		_ = cw.Write([]string{section, key, metric, fmt.Sprint(value)})
+	}
+	row("section", "key", "metric", "value")
+	row("summary", "", "run_id", r.RunID)
+	row("summary", "", "mode", r.Mode)
+	row("summary", "", "started", r.Started.Format(time.RFC3339Nano))
+	row("summary", "", "finished", r.Finished.Format(time.RFC3339Nano))
+	row("summary", "", "seconds", r.Seconds)
+	row("summary", "", "produced", r.Produced)
+	row("summary", "", "acked", r.Acked)
+	row("summary", "", "errors", r.Errors)
+	for _, p := range []string{"p50", "p90", "p99", "p99.9", "max"} {
+		if v, ok := r.AckLatencyMS[p]; ok {
+			row("ack_latency_ms", "", p, v)
+		}
+	}
+	for _, k := range sortedKeys(r.ErrorsByType) {
+		row("errors", k, "count", r.ErrorsByType[k])
+	}
+	for _, s := range r.PerSecond {
+		key := strconv.Itoa(s.Second)
+		row("per_second", key, "produced", s.Produced)
+		row("per_second", key, "acked", s.Acked)
+		row("per_second", key, "errors", s.Errors)
+	}
+	if v := r.Verification; v != nil {
+		row("verification", "", "acked", v.Acked)
+		row("verification", "", "delivered", v.Delivered)
+		row("verification", "", "missing", v.Missing)
+		row("verification", "", "duplicated", v.Duplicated)
+		row("verification", "", "unacked", v.Unacked)
+		row("verification", "", "aborted", v.Aborted)
+		row("verification", "", "leaked", v.Leaked)
+		for _, p := range []string{"p50", "p90", "p99", "max"} {
+			if d, ok := v.Latency[p]; ok {
+				row("verification", "", "latency_ms_"+p, float64(d.Microseconds())/1000)
+			}
+		}
+	}
+	for _, in := range r.Instances {
+		key := strconv.Itoa(in.Instance)
+		row("instance", key, "run_id", in.RunID)
+		row("instance", key, "produced", in.Produced)
+		row("instance", key, "acked", in.Acked)
+		row("instance", key, "errors", in.Errors)
+	}
+	for _, k := range sortedKeys(r.Config) {
+		row("config", k, "value", r.Config[k])
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,35 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/IBM/sarama"
+)
+
+func TestErrorType(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"kafka error", &sarama.ProducerError{Err: sarama.ErrNotLeaderForPartition}, sarama.ErrNotLeaderForPartition.Error()},
+		{"client error", &sarama.ProducerError{Err: sarama.ErrOutOfBrokers}, "ErrOutOfBrokers"},
+		{"wrapped client error", fmt.Errorf("produce: %w", sarama.ErrShuttingDown), "ErrShuttingDown"},
+		{"transaction error", fmt.Errorf("commit transaction: %w", sarama.ErrTransactionNotReady), "ErrTransactionNotReady"},
+		{"kafka error in a transaction error", sarama.Wrap(sarama.ErrTxnOffsetCommit, sarama.ErrOffsetMetadataTooLarge), sarama.ErrOffsetMetadataTooLarge.Error()},
+		{"timeout", &sarama.ProducerError{Err: &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}}, "timeout"},
+		{"typed error", &sarama.ProducerError{Err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}}, "syscall.Errno"},
+		{"outer type of a plain error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("refused")}, "*net.OpError"},
+		{"plain error", fmt.Errorf("send: %w", errors.New("boom")), "other"},
+		{"plain producer error", &sarama.ProducerError{Err: errors.New("boom")}, "other"},
+	} {
+		if have := errorType(tc.err); have != tc.want {
+			t.Errorf("%s: want %q, have %q", tc.name, tc.want, have)
+		}
+	}
+}
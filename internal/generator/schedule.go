@@ -0,0 +1,314 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Phase kinds accepted in GEN_RATE_SCHEDULE.
+const (
+	PhaseConstant = "constant"
+	PhaseHold     = "hold"
+	PhaseRamp     = "ramp"
+	PhaseBurst    = "burst"
+	PhaseSine     = "sine"
+	PhaseStep     = "step"
+)
+
+// Phase is one segment of a traffic schedule. Rates are messages per second.
+type Phase struct {
+	Kind string
+	// From and To bound the rate: hold uses From, ramp and step go from From
+	// to To, sine oscillates between them.
+	From, To float64
+	// Increment and Hold describe a step phase; Period a sine phase.
+	Increment float64
+	Hold      time.Duration
+	Period    time.Duration
+	// Duration of the phase; zero means forever for constant phases.
+	Duration time.Duration
+	// Count is the number of messages a burst sends without rate limiting.
+	Count int64
+}
+
+// RateAt returns the target rate at offset into the phase.
+func (p Phase) RateAt(offset time.Duration) float64 {
+	switch p.Kind {
+	case PhaseRamp:
+		frac := math.Min(1, float64(offset)/float64(p.Duration))
+		return p.From + (p.To-p.From)*frac
+	case PhaseSine:
+		mid, amp := (p.From+p.To)/2, (p.To-p.From)/2
+		return mid + amp*math.Sin(2*math.Pi*float64(offset)/float64(p.Period))
+	case PhaseStep:
+		r := p.From + p.Increment*float64(offset/p.Hold)
+		if p.Increment >= 0 {
+			return math.Min(r, p.To)
+		}
+		return math.Max(r, p.To)
+	case PhaseBurst:
+		return math.Inf(1)
+	default:
+		return p.From
+	}
+}
+
+func (p Phase) String() string {
+	switch p.Kind {
+	case PhaseRamp:
+		return fmt.Sprintf("ramp %g->%g over %s", p.From, p.To, p.Duration)
+	case PhaseSine:
+		return fmt.Sprintf("sine %g..%g period %s for %s", p.From, p.To, p.Period, p.Duration)
+	case PhaseStep:
+		return fmt.Sprintf("step %g->%g by %g every %s", p.From, p.To, p.Increment, p.Hold)
+	case PhaseBurst:
+		return fmt.Sprintf("burst of %d", p.Count)
+	case PhaseHold:
+		return fmt.Sprintf("hold %g for %s", p.From, p.Duration)
+	default:
+		return fmt.Sprintf("constant %g", p.From)
+	}
+}
+
+// ParseSchedule parses a semicolon-separated list of phases:
+//
+//	hold RATE DURATION
+//	ramp FROM TO DURATION
+//	burst COUNT
+//	sine MIN MAX PERIOD DURATION
+//	step FROM TO INCREMENT HOLD
+//
+// e.g. "ramp 100 5000 5m; hold 5000 2m; burst 20000; step 1000 5000 1000 30s".
+func ParseSchedule(spec string) ([]Phase, error) {
+	var phases []Phase
+	for i, raw := range strings.Split(spec, ";") {
+		fields := strings.Fields(raw)
+		if len(fields) == 0 {
+			continue
+		}
+		phase, err := parsePhase(fields)
+		if err != nil {
+			return nil, fmt.Errorf("phase %d %q: %w", i+1, strings.TrimSpace(raw), err)
+		}
+		phases = append(phases, phase)
+	}
+	if len(phases) == 0 {
+		return nil, fmt.Errorf("schedule has no phases")
+	}
+	return phases, nil
+}
+
+func parsePhase(fields []string) (Phase, error) {
+	kind, args := strings.ToLower(fields[0]), fields[1:]
+	want := map[string]int{PhaseHold: 2, PhaseRamp: 3, PhaseBurst: 1, PhaseSine: 4, PhaseStep: 4}
+	n, ok := want[kind]
+	if !ok {
+		return Phase{}, fmt.Errorf("unknown phase kind %q", kind)
+	}
+	if len(args) != n {
+		return Phase{}, fmt.Errorf("%s takes %d arguments, got %d", kind, n, len(args))
+	}
+
+	p := Phase{Kind: kind}
+	var err error
+	rateArg := func(s string) float64 {
+		if err != nil {
+			return 0
+		}
+		var v float64
+		if v, err = strconv.ParseFloat(s, 64); err == nil && v < 0 {
+			err = fmt.Errorf("rate %q must be >= 0", s)
+		}
+		return v
+	}
+	durationArg := func(s string) time.Duration {
+		if err != nil {
+			return 0
+		}
+		var d time.Duration
+		if d, err = time.ParseDuration(s); err == nil && d <= 0 {
+			err = fmt.Errorf("duration %q must be > 0", s)
+		}
+		return d
+	}
+
+	switch kind {
+	case PhaseHold:
+		p.From, p.Duration = rateArg(args[0]), durationArg(args[1])
+		p.To = p.From
+	case PhaseRamp:
+		p.From, p.To, p.Duration = rateArg(args[0]), rateArg(args[1]), durationArg(args[2])
+	case PhaseBurst:
+		p.Count, err = strconv.ParseInt(args[0], 10, 64)
+		if err == nil && p.Count <= 0 {
+			err = fmt.Errorf("count must be > 0")
+		}
+	case PhaseSine:
+		p.From, p.To, p.Period, p.Duration = rateArg(args[0]), rateArg(args[1]), durationArg(args[2]), durationArg(args[3])
+	case PhaseStep:
+		p.From, p.To, p.Hold = rateArg(args[0]), rateArg(args[1]), durationArg(args[3])
+		if err == nil {
+			p.Increment, err = strconv.ParseFloat(args[2], 64)
+		}
+		if err == nil && (p.Increment == 0 || (p.To-p.From)*p.Increment < 0) {
+			err = fmt.Errorf("increment %s does not move %g towards %g", args[2], p.From, p.To)
+		}
+		if err == nil {
+			steps := math.Floor(math.Abs(p.To-p.From)/math.Abs(p.Increment)) + 1
+			p.Duration = time.Duration(steps) * p.Hold
+		}
+	}
+	return p, err
+}
+
+// ShareSchedule returns one instance's part of a schedule split evenly over
+// instances: rates are divided, and burst counts split like Share.
+func ShareSchedule(phases []Phase, instance, instances int) []Phase {
+	out := make([]Phase, len(phases))
+	n := float64(instances)
+	for i, p := range phases {
+		p.From, p.To, p.Increment = p.From/n, p.To/n, p.Increment/n
+		p.Count = Share(p.Count, instance, instances)
+		out[i] = p
+	}
+	return out
+}
+
+// Share splits total evenly over instances, giving the remainder to the
+// lowest indexes.
+func Share(total int64, instance, instances int) int64 {
+	n := int64(instances)
+	share := total / n
+	if int64(instance) < total%n {
+		share++
+	}
+	return share
+}
+
+// Pacer paces a producer through a schedule of phases.
+type Pacer struct {
+	phases  []Phase
+	limiter *rate.Limiter
+
+	mu         sync.Mutex
+	index      int
+	phaseStart time.Time
+	sent       int64 // messages released by the current burst
+	target     float64
+}
+
+// NewPacer paces through phases. The first phase starts on the first Wait,
+// so a coordinated run can build its pacer before the shared start time.
+func NewPacer(phases []Phase) *Pacer {
+	return &Pacer{phases: phases, limiter: rate.NewLimiter(0, 1)}
+}
+
+// Wait blocks until the next message may be sent. It returns false once the
+// schedule is complete.
+func (p *Pacer) Wait(ctx context.Context) (bool, error) {
+	for {
+		target, ok := p.next()
+		if !ok {
+			return false, nil
+		}
+		if math.IsInf(target, 1) {
+			return true, ctx.Err()
+		}
+		if target > 0 {
+			// Take a token only if it is due soon; otherwise give it back and
+			// look again, so a rising rate is not stuck behind a long wait
+			// reserved at the old one.
+			r := p.limiter.Reserve()
+			if delay := r.Delay(); delay <= idlePoll {
+				return true, sleep(ctx, delay)
+			}
+			r.Cancel()
+		}
+		if err := sleep(ctx, idlePoll); err != nil {
+			return true, err
+		}
+	}
+}
+
+// idlePoll bounds how long Wait sleeps before re-evaluating the target rate.
+const idlePoll = 100 * time.Millisecond
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// next advances past finished phases and applies the current target rate to
+// the limiter. It reports false once every phase is done.
+func (p *Pacer) next() (float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.phaseStart.IsZero() {
+		p.phaseStart = now
+		p.logPhase()
+	}
+	for p.index < len(p.phases) && p.finished(p.phases[p.index], now) {
+		p.index++
+		p.phaseStart, p.sent = now, 0
+		if p.index < len(p.phases) {
+			p.logPhase()
+		}
+	}
+	if p.index >= len(p.phases) {
+		p.target = 0
+		return 0, false
+	}
+	target := p.phases[p.index].RateAt(now.Sub(p.phaseStart))
+	p.target = target
+	if math.IsInf(target, 1) {
+		p.sent++
+	} else if target > 0 {
+		p.limiter.SetLimitAt(now, rate.Limit(target))
+		// About 100ms of headroom, so rate changes take effect quickly.
+		p.limiter.SetBurstAt(now, max(1, int(target/10)))
+	}
+	return target, true
+}
+
+func (p *Pacer) finished(phase Phase, now time.Time) bool {
+	if phase.Kind == PhaseBurst {
+		return p.sent >= phase.Count
+	}
+	return phase.Duration > 0 && now.Sub(p.phaseStart) >= phase.Duration
+}
+
+// TargetRate is the rate the current phase asks for; +Inf during a burst.
+func (p *Pacer) TargetRate() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.target
+}
+
+// PhaseIndex is the zero-based index of the current phase.
+func (p *Pacer) PhaseIndex() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.index
+}
+
+func (p *Pacer) logPhase() {
+	slog.Info("rate phase started", "phase", p.index+1, "of", len(p.phases), "spec", p.phases[p.index].String())
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		want    []Phase
+		wantErr bool
+	}{
+		{spec: "hold 500 2m", want: []Phase{{Kind: PhaseHold, From: 500, To: 500, Duration: 2 * time.Minute}}},
+		{spec: "ramp 100 5000 5m; burst 20000", want: []Phase{
+			{Kind: PhaseRamp, From: 100, To: 5000, Duration: 5 * time.Minute},
+			{Kind: PhaseBurst, Count: 20000},
+		}},
+		{spec: " SINE 100 300 1m 10m ;", want: []Phase{{Kind: PhaseSine, From: 100, To: 300, Period: time.Minute, Duration: 10 * time.Minute}}},
+		{spec: "step 1000 5000 1000 30s", want: []Phase{{Kind: PhaseStep, From: 1000, To: 5000, Increment: 1000, Hold: 30 * time.Second, Duration: 150 * time.Second}}},
+		{spec: "step 5000 1000 -2000 10s", want: []Phase{{Kind: PhaseStep, From: 5000, To: 1000, Increment: -2000, Hold: 10 * time.Second, Duration: 30 * time.Second}}},
+		{spec: "", wantErr: true},
+		{spec: " ; ", wantErr: true},
+		{spec: "warp 9", wantErr: true},
+		{spec: "hold 500", wantErr: true},
+		{spec: "hold -1 1m", wantErr: true},
+		{spec: "hold 500 0s", wantErr: true},
+		{spec: "ramp 1 x 1m", wantErr: true},
+		{spec: "burst 0", wantErr: true},
+		{spec: "step 1000 5000 -100 1s", wantErr: true},
+		{spec: "step 1000 5000 0 1s", wantErr: true},
+	} {
+		got, err := ParseSchedule(tc.spec)
+		switch {
+		case tc.wantErr && err == nil:
+			t.Errorf("ParseSchedule(%q): want error, have %+v", tc.spec, got)
+		case !tc.wantErr && err != nil:
+			t.Errorf("ParseSchedule(%q): %v", tc.spec, err)
+		case !tc.wantErr && !reflect.DeepEqual(got, tc.want):
+			t.Errorf("ParseSchedule(%q):\nwant %+v\nhave %+v", tc.spec, tc.want, got)
+		}
+	}
+}
+
+func TestPhaseRateAt(t *testing.T) {
+	for _, tc := range []struct {
+		phase  Phase
+		offset time.Duration
+		want   float64
+	}{
+		{Phase{Kind: PhaseHold, From: 50}, time.Hour, 50},
+		{Phase{Kind: PhaseRamp, From: 100, To: 200, Duration: 10 * time.Second}, 5 * time.Second, 150},
+		{Phase{Kind: PhaseRamp, From: 100, To: 200, Duration: 10 * time.Second}, time.Minute, 200},
+		{Phase{Kind: PhaseSine, From: 100, To: 300, Period: 4 * time.Second}, time.Second, 300},
+		{Phase{Kind: PhaseSine, From: 100, To: 300, Period: 4 * time.Second}, 3 * time.Second, 100},
+		{Phase{Kind: PhaseStep, From: 10, To: 30, Increment: 10, Hold: time.Second}, 1500 * time.Millisecond, 20},
+		{Phase{Kind: PhaseStep, From: 10, To: 30, Increment: 10, Hold: time.Second}, time.Minute, 30},
+		{Phase{Kind: PhaseStep, From: 30, To: 10, Increment: -10, Hold: time.Second}, time.Minute, 10},
+		{Phase{Kind: PhaseBurst, Count: 5}, 0, math.Inf(1)},
+	} {
+		if got := tc.phase.RateAt(tc.offset); got != tc.want && math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("%s at %s: want %g, have %g", tc.phase, tc.offset, tc.want, got)
+		}
+	}
+}
+
+func TestShareSchedule(t *testing.T) {
+	phases := []Phase{{Kind: PhaseHold, From: 300, To: 300}, {Kind: PhaseBurst, Count: 10}}
+	var total int64
+	for i := 0; i < 3; i++ {
+		share := ShareSchedule(phases, i, 3)
+		if share[0].From != 100 {
+			t.Errorf("instance %d: want rate 100, have %g", i, share[0].From)
+		}
+		total += share[1].Count
+	}
+	if total != 10 {
+		t.Errorf("want burst shares to add up to 10, have %d", total)
+	}
+	if got := []int64{Share(10, 0, 3), Share(10, 1, 3), Share(10, 2, 3)}; !reflect.DeepEqual(got, []int64{4, 3, 3}) {
+		t.Errorf("want shares [4 3 3], have %v", got)
+	}
+}
@@ -0,0 +1,75 @@
+package generator
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// WeightedTopic is one destination of a fan-out.
+type WeightedTopic struct {
+	Name   string
+	Weight int
+}
+
+// ParseTopics parses comma-separated topic:weight pairs; a missing weight
+// counts as 1. "orders:3,payments:1" sends three of every four messages to
+// orders.
+func ParseTopics(spec string) ([]WeightedTopic, error) {
+	var topics []WeightedTopic
+	seen := make(map[string]bool)
+	for _, item := range splitAndTrim(spec) {
+		name, weightRaw, hasWeight := strings.Cut(item, ":")
+		name = strings.TrimSpace(name)
+		t := WeightedTopic{Name: name, Weight: 1}
+		if hasWeight {
+			w, err := strconv.Atoi(strings.TrimSpace(weightRaw))
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("topic %q: weight must be a positive integer", item)
+			}
+			t.Weight = w
+		}
+		if name == "" {
+			return nil, fmt.Errorf("topic %q: missing name", item)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("topic %s listed twice", name)
+		}
+		seen[name] = true
+		topics = append(topics, t)
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("no topics")
+	}
+	return topics, nil
+}
+
+// TopicPicker chooses a destination for each message in proportion to the
+// topic weights. It is not safe for concurrent use.
+type TopicPicker struct {
+	topics     []WeightedTopic
+	cumulative []int
+	rng        *rand.Rand
+}
+
+// NewTopicPicker builds a picker over topics, which must not be empty.
+func NewTopicPicker(topics []WeightedTopic, rng *rand.Rand) *TopicPicker {
+	p := &TopicPicker{topics: topics, cumulative: make([]int, len(topics)), rng: rng}
+	total := 0
+	for i, t := range topics {
+		total += t.Weight
+		p.cumulative[i] = total
+	}
+	return p
+}
+
+// Pick returns the next message's topic.
+func (p *TopicPicker) Pick() string {
+	if len(p.topics) == 1 {
+		return p.topics[0].Name
+	}
+	n := p.rng.Intn(p.cumulative[len(p.cumulative)-1])
+	return p.topics[sort.SearchInts(p.cumulative, n+1)].Name
+}
@@ -0,0 +1,355 @@
+package generator
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"demo/internal/storage"
+)
+
+// Header names stamped on every message so rows can be matched back to a run.
+// The worker stores header values base64-encoded in its jsonb column.
+const (
+	HeaderRunID      = "gen-run-id"
+	HeaderSeq        = "gen-seq"
+	HeaderProducedAt = "gen-produced-at"
+)
+
+// Report summarises how much of a run reached the target table.
+type Report struct {
+	RunID string `json:"run_id"`
+	// Acked counts messages the brokers acknowledged, excluding aborted ones.
+	Acked int64 `json:"acked"`
+	// Aborted counts acknowledged messages of deliberately aborted
+	// transactions, which must never reach the table.
+	Aborted int64 `json:"aborted"`
+	// Leaked counts rows written from aborted transactions.
+	Leaked int64 `json:"leaked"`
+	// Delivered counts acknowledged offsets found in the table.
+	Delivered int64 `json:"delivered"`
+	// Missing counts acknowledged offsets not found before the timeout.
+	Missing int64 `json:"missing"`
+	// Duplicated counts rows whose sequence number was already written at
+	// another offset, e.g. after a producer retry.
+	Duplicated int64 `json:"duplicated"`
+	// Unacked counts rows of the run at offsets never acknowledged to us.
+	Unacked int64                    `json:"unacked"`
+	Latency map[string]time.Duration `json:"latency"`
+	Waited  time.Duration            `json:"waited"`
+}
+
+// Passed reports whether every acknowledged message arrived exactly once and
+// nothing from an aborted transaction did.
+func (r Report) Passed() bool {
+	return r.Missing == 0 && r.Duplicated == 0 && r.Leaked == 0
+}
+
+// Verifier records acknowledged offsets during a run and then checks them
+// against the table the worker writes to.
+type Verifier struct {
+	runID string
+	table string
+
+	mu sync.Mutex
+	// acked maps each acknowledged offset to whether its transaction was
+	// aborted.
+	acked   map[topicPartition]map[int64]bool
+	total   int64
+	aborted int64
+	// txns holds the acknowledged offsets of each transaction, in case its
+	// commit fails; failedTxns the transactions whose commit did.
+	txns       map[int64][]ackedOffset
+	failedTxns map[int64]bool
+}
+
+type ackedOffset struct {
+	topicPartition
+	offset int64
+}
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// NewVerifier creates a verifier for one run.
+func NewVerifier(runID, table string) *Verifier {
+	return &Verifier{
+		runID:      runID,
+		table:      table,
+		acked:      make(map[topicPartition]map[int64]bool),
+		txns:       make(map[int64][]ackedOffset),
+		failedTxns: make(map[int64]bool),
+	}
+}
+
+// Ack records an acknowledged message. txn numbers the producer transaction
+// it was sent in, 0 outside transactions; aborted marks a transaction that is
+// aborted on purpose.
+func (v *Verifier) Ack(topic string, partition int32, offset int64, txn int64, aborted bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	tp := topicPartition{topic: topic, partition: partition}
+	offsets := v.acked[tp]
+	if offsets == nil {
+		offsets = make(map[int64]bool)
+		v.acked[tp] = offsets
+	}
+	aborted = aborted || v.failedTxns[txn]
+	offsets[offset] = aborted
+	switch {
+	case aborted:
+		v.aborted++
+	default:
+		v.total++
+		if txn != 0 {
+			v.txns[txn] = append(v.txns[txn], ackedOffset{topicPartition: tp, offset: offset})
+		}
+	}
+}
+
+// MarkAborted records that transaction txn was aborted after all, e.g. after
+// its commit failed. Its messages count as aborted, including any whose
+// acknowledgement has not been recorded yet.
+func (v *Verifier) MarkAborted(txn int64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.failedTxns[txn] = true
+	for _, a := range v.txns[txn] {
+		v.acked[a.topicPartition][a.offset] = true
+		v.total--
+		v.aborted++
+	}
+	delete(v.txns, txn)
+}
+
+// Acked returns the number of acknowledged messages that should reach the
+// table.
+func (v *Verifier) Acked() int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.total
+}
+
+// offsetRange is the span of acknowledged offsets in one partition, which
+// bounds the primary key range the queries scan.
+type offsetRange struct {
+	topicPartition
+	min, max int64
+}
+
+func (v *Verifier) ranges() []offsetRange {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var out []offsetRange
+	for tp, offsets := range v.acked {
+		r := offsetRange{topicPartition: tp, min: -1}
+		for offset := range offsets {
+			if r.min < 0 || offset < r.min {
+				r.min = offset
+			}
+			if offset > r.max {
+				r.max = offset
+			}
+		}
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].topic != out[j].topic {
+			return out[i].topic < out[j].topic
+		}
+		return out[i].partition < out[j].partition
+	})
+	return out
+}
+
+// Verify polls the table every interval until every acknowledged message
+// has a row or timeout elapses, then compares rows and acknowledgements.
+func (v *Verifier) Verify(ctx context.Context, dsn string, interval, timeout time.Duration) (Report, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return Report{}, fmt.Errorf("connect postgres: %w", err)
+	}
+	defer pool.Close()
+
+	ranges := v.ranges()
+	acked := v.Acked()
+	started := time.Now()
+	deadline := started.Add(timeout)
+	for {
+		found, err := v.delivered(ctx, pool, ranges)
+		if err != nil {
+			return Report{}, err
+		}
+		slog.Info("verifying delivery", "run_id", v.runID, "found", found, "acked", acked)
+		if found >= acked || time.Now().After(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return Report{}, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+
+	report, err := v.compare(ctx, pool, ranges)
+	report.Waited = time.Since(started)
+	return report, err
+}
+
+// delivered counts rows at acknowledged offsets of committed transactions.
+// Leaked and unacknowledged rows share the scanned range but must not end
+// the wait early, so only offsets in the acked set are counted.
+func (v *Verifier) delivered(ctx context.Context, pool *pgxpool.Pool, ranges []offsetRange) (int64, error) {
+	query := fmt.Sprintf(`SELECT message_offset FROM %s
+		WHERE topic = $1 AND partition = $2 AND message_offset BETWEEN $3 AND $4
+		AND headers->>'%s' = $5`, storage.QuoteIdentifier(v.table), HeaderRunID)
+	run := encodeHeader(v.runID)
+	var total int64
+	for _, r := range ranges {
+		rows, err := pool.Query(ctx, query, r.topic, r.partition, r.min, r.max, run)
+		if err != nil {
+			return 0, fmt.Errorf("count rows: %w", err)
+		}
+		var offsets []int64
+		var offset int64
+		if _, err := pgx.ForEachRow(rows, []any{&offset}, func() error {
+			offsets = append(offsets, offset)
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("count rows: %w", err)
+		}
+		v.mu.Lock()
+		for _, offset := range offsets {
+			if aborted, ok := v.acked[r.topicPartition][offset]; ok && !aborted {
+				total++
+			}
+		}
+		v.mu.Unlock()
+	}
+	return total, nil
+}
+
+func (v *Verifier) compare(ctx context.Context, pool *pgxpool.Pool, ranges []offsetRange) (Report, error) {
+	query := fmt.Sprintf(`SELECT message_offset, headers->>'%s', headers->>'%s', ingested_at FROM %s
+		WHERE topic = $1 AND partition = $2 AND message_offset BETWEEN $3 AND $4
+		AND headers->>'%s' = $5`, HeaderSeq, HeaderProducedAt, storage.QuoteIdentifier(v.table), HeaderRunID)
+	run := encodeHeader(v.runID)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	t := v.newTally()
+	for _, r := range ranges {
+		rows, err := pool.Query(ctx, query, r.topic, r.partition, r.min, r.max, run)
+		if err != nil {
+			return t.report, fmt.Errorf("read rows: %w", err)
+		}
+		var row tableRow
+		row.topicPartition = r.topicPartition
+		_, err = pgx.ForEachRow(rows, []any{&row.offset, &row.seq, &row.producedAt, &row.ingestedAt}, func() error {
+			t.add(row)
+			return nil
+		})
+		if err != nil {
+			return t.report, fmt.Errorf("read rows: %w", err)
+		}
+	}
+	return t.finish(), nil
+}
+
+// tableRow is one row of the run found in the table.
+type tableRow struct {
+	topicPartition
+	offset     int64
+	seq        *string
+	producedAt *string
+	ingestedAt time.Time
+}
+
+// tally matches table rows against the acknowledged offsets. v.mu must be
+// held while it is in use.
+type tally struct {
+	v         *Verifier
+	report    Report
+	seen      map[string]struct{}
+	latencies []time.Duration
+}
+
+func (v *Verifier) newTally() *tally {
+	return &tally{
+		v:      v,
+		report: Report{RunID: v.runID, Acked: v.total, Aborted: v.aborted},
+		seen:   make(map[string]struct{}),
+	}
+}
+
+func (t *tally) add(row tableRow) {
+	if row.seq != nil {
+		if _, ok := t.seen[*row.seq]; ok {
+			t.report.Duplicated++
+		}
+		t.seen[*row.seq] = struct{}{}
+	}
+	aborted, ok := t.v.acked[row.topicPartition][row.offset]
+	switch {
+	case !ok:
+		t.report.Unacked++
+		return
+	case aborted:
+		t.report.Leaked++
+		return
+	}
+	t.report.Delivered++
+	if row.producedAt != nil {
+		if sent, err := decodeTime(*row.producedAt); err == nil {
+			t.latencies = append(t.latencies, row.ingestedAt.Sub(sent))
+		}
+	}
+}
+
+func (t *tally) finish() Report {
+	t.report.Missing = t.report.Acked - t.report.Delivered
+	t.report.Latency = percentiles(t.latencies)
+	return t.report
+}
+
+// percentiles returns nearest-rank p50, p90, p99 and max.
+func percentiles(samples []time.Duration) map[string]time.Duration {
+	if len(samples) == 0 {
+		return nil
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	at := func(p float64) time.Duration {
+		idx := int(math.Ceil(p*float64(len(samples)))) - 1
+		return samples[max(idx, 0)]
+	}
+	return map[string]time.Duration{
+		"p50": at(0.50),
+		"p90": at(0.90),
+		"p99": at(0.99),
+		"max": samples[len(samples)-1],
+	}
+}
+
+// encodeHeader matches how the worker stores a header value in jsonb:
+// encoding/json renders []byte as standard base64.
+func encodeHeader(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func decodeTime(encoded string) (time.Time, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, string(raw))
+}
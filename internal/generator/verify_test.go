@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// delivered builds the rows the worker would have written for offsets.
+func delivered(topic string, partition int32, offsets ...int64) []tableRow {
+	rows := make([]tableRow, len(offsets))
+	for i, offset := range offsets {
+		seq := encodeHeader(fmt.Sprintf("%s-%d-%d", topic, partition, offset))
+		rows[i] = tableRow{topicPartition: topicPartition{topic, partition}, offset: offset, seq: &seq, ingestedAt: time.Now()}
+	}
+	return rows
+}
+
+func tallyRows(v *Verifier, rows []tableRow) Report {
+	t := v.newTally()
+	for _, row := range rows {
+		t.add(row)
+	}
+	return t.finish()
+}
+
+func TestVerifierReport(t *testing.T) {
+	v := NewVerifier("run", "events")
+	for offset := int64(0); offset < 4; offset++ {
+		v.Ack("orders", 0, offset, 0, false)
+	}
+	v.Ack("orders", 0, 4, 1, true)
+
+	rows := delivered("orders", 0, 0, 1, 2, 4, 9)
+	report := tallyRows(v, rows)
+	want := Report{RunID: "run", Acked: 4, Aborted: 1, Delivered: 3, Missing: 1, Leaked: 1, Unacked: 1}
+	report.Latency = nil
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("want %+v\nhave %+v", want, report)
+	}
+
+	dup := rows[0]
+	dup.offset = 3
+	report = tallyRows(v, append(rows[:3:3], dup))
+	if report.Duplicated != 1 {
+		t.Errorf("want 1 duplicate, have %d", report.Duplicated)
+	}
+}
+
+func TestVerifierMarkAborted(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		run  func(v *Verifier)
+	}{
+		{name: "acks before the failed commit", run: func(v *Verifier) {
+			v.Ack("orders", 0, 0, 1, false)
+			v.Ack("orders", 0, 1, 1, false)
+			v.MarkAborted(1)
+		}},
+		{name: "acks after the failed commit", run: func(v *Verifier) {
+			v.Ack("orders", 0, 0, 1, false)
+			v.MarkAborted(1)
+			v.Ack("orders", 0, 1, 1, false)
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewVerifier("run", "events")
+			tc.run(v)
+			v.Ack("orders", 0, 2, 2, false)
+			v.Ack("orders", 0, 3, 2, false)
+
+			report := tallyRows(v, delivered("orders", 0, 2, 3))
+			if report.Missing != 0 || report.Acked != 2 || report.Aborted != 2 || !report.Passed() {
+				t.Errorf("want transaction 1 counted as aborted, have %+v", report)
+			}
+			if leaked := tallyRows(v, delivered("orders", 0, 0, 2, 3)).Leaked; leaked != 1 {
+				t.Errorf("want a row of the failed transaction to count as leaked, have %d", leaked)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check is a single named probe. Run should return promptly once ctx expires.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is the per-check outcome included in the probe response body.
+type Result struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// Report is the JSON body returned by a probe endpoint.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Handler runs every check concurrently within timeout and responds 200 when
+// all pass or 503 otherwise, always with per-check detail.
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		report := Run(ctx, checks...)
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+// Run executes checks concurrently and aggregates their results.
+func Run(ctx context.Context, checks ...Check) Report {
+	report := Report{Status: "ok", Checks: make(map[string]Result, len(checks))}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+			start := time.Now()
+			err := runWithContext(ctx, check.Run)
+			res := Result{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = err.Error()
+			}
+			mu.Lock()
+			report.Checks[check.Name] = res
+			if err != nil {
+				report.Status = "fail"
+			}
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+	return report
+}
+
+// runWithContext guards against checks that ignore ctx, such as sarama calls
+// bounded only by client-level timeouts.
+func runWithContext(ctx context.Context, fn func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
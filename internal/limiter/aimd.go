@@ -0,0 +1,169 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Options configure an AIMD limiter.
+type Options struct {
+	Initial int
+	Min     int
+	Max     int
+	// LatencyThreshold marks a successful call that took longer than this as
+	// congestion, just like an error.
+	LatencyThreshold time.Duration
+	// BackoffRatio multiplies the limit on congestion; defaults to 0.9.
+	BackoffRatio float64
+}
+
+// AIMD caps concurrent calls with a limit that grows by one while calls
+// succeed quickly and the limit is actually in use, and shrinks
+// multiplicatively on errors or slow calls, in the style of Netflix's
+// concurrency-limits AIMDLimit.
+type AIMD struct {
+	opts Options
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	waiters  []chan struct{}
+}
+
+// New builds an AIMD limiter, filling unset options with defaults.
+func New(opts Options) *AIMD {
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max < opts.Min {
+		opts.Max = opts.Min
+	}
+	if opts.Initial < opts.Min {
+		opts.Initial = opts.Min
+	}
+	if opts.Initial > opts.Max {
+		opts.Initial = opts.Max
+	}
+	if opts.BackoffRatio <= 0 || opts.BackoffRatio >= 1 {
+		opts.BackoffRatio = 0.9
+	}
+	return &AIMD{opts: opts, limit: float64(opts.Initial)}
+}
+
+// Acquire blocks until a slot is available or ctx is done. The returned
+// release function must be called exactly once with the call's latency and
+// outcome.
+func (l *AIMD) Acquire(ctx context.Context) (func(time.Duration, error), error) {
+	l.mu.Lock()
+	if l.inFlight < l.currentLocked() {
+		l.inFlight++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	ready := make(chan struct{})
+	l.waiters = append(l.waiters, ready)
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return l.release, nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		for i, w := range l.waiters {
+			if w == ready {
+				l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+				l.mu.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		// Granted concurrently with cancellation: hand the slot back.
+		l.inFlight--
+		l.grantLocked()
+		l.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (l *AIMD) release(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inUse := l.inFlight
+	l.inFlight--
+	switch {
+	case err != nil && !Congestion(err):
+		// The caller gave up or the batch itself was bad; that says nothing
+		// about how loaded the database is.
+	case err != nil || (l.opts.LatencyThreshold > 0 && latency > l.opts.LatencyThreshold):
+		l.limit = math.Max(float64(l.opts.Min), math.Floor(l.limit*l.opts.BackoffRatio))
+	case inUse*2 >= l.currentLocked():
+		// Only grow while the limit is actually constraining throughput.
+		l.limit = math.Min(float64(l.opts.Max), l.limit+1)
+	}
+	l.grantLocked()
+}
+
+func (l *AIMD) grantLocked() {
+	for len(l.waiters) > 0 && l.inFlight < l.currentLocked() {
+		w := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+		close(w)
+	}
+}
+
+func (l *AIMD) currentLocked() int {
+	return int(l.limit)
+}
+
+// Limit returns the current concurrency limit.
+func (l *AIMD) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.currentLocked()
+}
+
+// InFlight returns the number of calls holding a slot.
+func (l *AIMD) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Waiting returns the number of callers blocked in Acquire.
+func (l *AIMD) Waiting() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.waiters)
+}
+
+// Congestion reports whether err suggests the database is overloaded or
+// briefly unavailable, which should lower the limit. Cancellation and
+// deadlines from shutdown, and errors caused by the data itself such as
+// constraint violations, do not.
+func Congestion(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		// Connection and network failures never reach the server.
+		return true
+	}
+	switch {
+	case strings.HasPrefix(pgErr.Code, "08"), // connection exception
+		strings.HasPrefix(pgErr.Code, "40"), // serialization failure, deadlock
+		strings.HasPrefix(pgErr.Code, "53"), // insufficient resources
+		strings.HasPrefix(pgErr.Code, "57"), // query canceled, admin shutdown
+		pgErr.Code == "55P03":               // lock not available
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,153 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestNewClampsOptions(t *testing.T) {
+	for _, tc := range []struct {
+		opts      Options
+		wantLimit int
+	}{
+		{Options{}, 1},
+		{Options{Initial: 8, Min: 2, Max: 16}, 8},
+		{Options{Initial: 1, Min: 4, Max: 16}, 4},
+		{Options{Initial: 64, Min: 2, Max: 16}, 16},
+		{Options{Initial: 5, Min: 10, Max: 3}, 10},
+	} {
+		if got := New(tc.opts).Limit(); got != tc.wantLimit {
+			t.Errorf("New(%+v).Limit(): want %d, have %d", tc.opts, tc.wantLimit, got)
+		}
+	}
+}
+
+func TestReleaseAdjustsLimit(t *testing.T) {
+	slow := 200 * time.Millisecond
+	for _, tc := range []struct {
+		name     string
+		inFlight int // slots held, including the one released
+		latency  time.Duration
+		err      error
+		want     int
+	}{
+		{name: "fast call under load grows", inFlight: 5, latency: time.Millisecond, want: 11},
+		{name: "fast call with idle limit holds", inFlight: 1, latency: time.Millisecond, want: 10},
+		{name: "slow call shrinks", inFlight: 5, latency: slow, want: 9},
+		{name: "connection error shrinks", inFlight: 5, err: errors.New("dial tcp: connection refused"), want: 9},
+		{name: "too many connections shrinks", inFlight: 5, err: &pgconn.PgError{Code: "53300"}, want: 9},
+		{name: "constraint violation holds", inFlight: 5, err: &pgconn.PgError{Code: "23505"}, want: 10},
+		{name: "cancellation holds", inFlight: 5, err: context.Canceled, want: 10},
+		{name: "deadline holds", inFlight: 5, err: fmt.Errorf("write: %w", context.DeadlineExceeded), want: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := New(Options{Initial: 10, Min: 2, Max: 20, LatencyThreshold: 100 * time.Millisecond})
+			var release func(time.Duration, error)
+			for i := 0; i < tc.inFlight; i++ {
+				var err error
+				if release, err = l.Acquire(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			release(tc.latency, tc.err)
+			if got := l.Limit(); got != tc.want {
+				t.Errorf("want limit %d, have %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestLimitStaysWithinBounds(t *testing.T) {
+	l := New(Options{Initial: 3, Min: 2, Max: 4})
+	for i := 0; i < 10; i++ {
+		release, _ := l.Acquire(context.Background())
+		release(0, errors.New("connection reset"))
+	}
+	if got := l.Limit(); got != 2 {
+		t.Errorf("want limit floored at 2, have %d", got)
+	}
+	for i := 0; i < 10; i++ {
+		a, _ := l.Acquire(context.Background())
+		b, _ := l.Acquire(context.Background())
+		a(0, nil)
+		b(0, nil)
+	}
+	if got := l.Limit(); got != 4 {
+		t.Errorf("want limit capped at 4, have %d", got)
+	}
+}
+
+func TestAcquireWaitsForSlot(t *testing.T) {
+	l := New(Options{Initial: 1, Min: 1, Max: 1})
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan func(time.Duration, error))
+	go func() {
+		next, _ := l.Acquire(context.Background())
+		acquired <- next
+	}()
+	deadline := time.Now().Add(time.Second)
+	for l.Waiting() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if l.Waiting() != 1 {
+		t.Fatalf("want one waiter, have %d", l.Waiting())
+	}
+
+	release(0, nil)
+	select {
+	case next := <-acquired:
+		next(0, nil)
+	case <-time.After(time.Second):
+		t.Fatal("waiter not granted the released slot")
+	}
+	if l.InFlight() != 0 {
+		t.Errorf("want no slots held, have %d", l.InFlight())
+	}
+}
+
+func TestAcquireGivesUpOnCancel(t *testing.T) {
+	l := New(Options{Initial: 1, Min: 1, Max: 1})
+	release, _ := l.Acquire(context.Background())
+	defer release(0, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, have %v", err)
+	}
+	if l.Waiting() != 0 || l.InFlight() != 1 {
+		t.Errorf("want 0 waiting and 1 in flight, have %d and %d", l.Waiting(), l.InFlight())
+	}
+}
+
+func TestCongestion(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("dial tcp: i/o timeout"), true},
+		{&pgconn.PgError{Code: "08006"}, true},
+		{&pgconn.PgError{Code: "40P01"}, true},
+		{&pgconn.PgError{Code: "53300"}, true},
+		{&pgconn.PgError{Code: "57014"}, true},
+		{&pgconn.PgError{Code: "55P03"}, true},
+		{fmt.Errorf("run batch: %w", &pgconn.PgError{Code: "53200"}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{&pgconn.PgError{Code: "22P02"}, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, false},
+	} {
+		if got := Congestion(tc.err); got != tc.want {
+			t.Errorf("Congestion(%v): want %t, have %t", tc.err, tc.want, got)
+		}
+	}
+}
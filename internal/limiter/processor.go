@@ -0,0 +1,36 @@
+package limiter
+
+import (
+	"context"
+	"time"
+
+	"demo/internal/worker"
+)
+
+// Processor caps concurrent ProcessBatch calls to the wrapped processor using
+// an AIMD limiter, so write concurrency settles at what the database sustains.
+type Processor struct {
+	next    worker.Processor
+	limiter *AIMD
+}
+
+// NewProcessor wraps next with limiter.
+func NewProcessor(next worker.Processor, limiter *AIMD) *Processor {
+	return &Processor{next: next, limiter: limiter}
+}
+
+// ProcessBatch waits for a slot, then delegates to the wrapped processor.
+// The wait is reported to the pool so adaptive batch sizing sees only the
+// write itself.
+func (p *Processor) ProcessBatch(ctx context.Context, records []worker.Record) error {
+	waiting := time.Now()
+	release, err := p.limiter.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	worker.ObserveQueued(ctx, started.Sub(waiting))
+	err = p.next.ProcessBatch(ctx, records)
+	release(time.Since(started), err)
+	return err
+}
@@ -0,0 +1,143 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options describe how log records are rendered and throttled.
+type Options struct {
+	Format string
+	Level  string
+	// RepeatLimit caps how many warnings or errors with the same message are
+	// emitted per RepeatWindow. Zero disables throttling.
+	RepeatLimit  int
+	RepeatWindow time.Duration
+}
+
+// New builds a logger writing JSON or text records to w.
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "json", "":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", opts.Format)
+	}
+
+	if opts.RepeatLimit > 0 && opts.RepeatWindow > 0 {
+		handler = NewRepeatLimiter(handler, opts.RepeatLimit, opts.RepeatWindow)
+	}
+	return slog.New(handler), nil
+}
+
+// ParseLevel maps debug, info, warn and error onto slog levels.
+func ParseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unsupported log level %q", value)
+	}
+	return level, nil
+}
+
+// RepeatLimiter is a slog.Handler that drops warnings and errors once the same
+// message has been logged limit times within window. The first record of the
+// next window carries a "suppressed" attribute with the number dropped, so an
+// outage produces a steady trickle instead of flooding stdout.
+type RepeatLimiter struct {
+	next  slog.Handler
+	state *repeatState
+}
+
+type repeatState struct {
+	mu      sync.Mutex
+	limit   int
+	window  time.Duration
+	buckets map[string]*repeatBucket
+}
+
+type repeatBucket struct {
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// NewRepeatLimiter wraps next with per-message throttling.
+func NewRepeatLimiter(next slog.Handler, limit int, window time.Duration) *RepeatLimiter {
+	return &RepeatLimiter{
+		next: next,
+		state: &repeatState{
+			limit:   limit,
+			window:  window,
+			buckets: make(map[string]*repeatBucket),
+		},
+	}
+}
+
+// Enabled reports whether the wrapped handler accepts level.
+func (h *RepeatLimiter) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle forwards r unless its message has exceeded the repeat budget.
+func (h *RepeatLimiter) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.next.Handle(ctx, r)
+	}
+	suppressed, ok := h.state.allow(r.Message, r.Time)
+	if !ok {
+		return nil
+	}
+	if suppressed > 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int("suppressed", suppressed))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+// WithAttrs returns a handler sharing the same throttling state.
+func (h *RepeatLimiter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &RepeatLimiter{next: h.next.WithAttrs(attrs), state: h.state}
+}
+
+// WithGroup returns a handler sharing the same throttling state.
+func (h *RepeatLimiter) WithGroup(name string) slog.Handler {
+	return &RepeatLimiter{next: h.next.WithGroup(name), state: h.state}
+}
+
+func (s *repeatState) allow(msg string, now time.Time) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[msg]
+	if !ok || now.Sub(b.start) >= s.window {
+		suppressed := 0
+		if ok {
+			suppressed = b.suppressed
+		}
+		s.buckets[msg] = &repeatBucket{start: now, count: 1}
+		return suppressed, true
+	}
+	if b.count >= s.limit {
+		b.suppressed++
+		return 0, false
+	}
+	b.count++
+	return 0, true
+}
@@ -3,16 +3,72 @@ package metrics
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 // Collector keeps simple counters for observability without external deps.
 type Collector struct {
-	processed atomic.Int64
-	errors    atomic.Int64
+	processed  atomic.Int64
+	errors     atomic.Int64
+	gapOffsets atomic.Int64
+	gaps       atomic.Int64
+
+	mu         sync.RWMutex
+	partitions map[partitionKey]*partitionState
+	series     []series
+}
+
+type series struct {
+	name string
+	kind string
+	read func() float64
+}
+
+// RegisterGauge exposes the value returned by read under name on every
+// scrape. Registering the same name twice exports it twice.
+func (c *Collector) RegisterGauge(name string, read func() float64) {
+	c.register(name, "gauge", read)
+}
+
+// RegisterCounter is RegisterGauge for values that only ever go up, so
+// scrapers can apply rate() across restarts of the source.
+func (c *Collector) RegisterCounter(name string, read func() float64) {
+	c.register(name, "counter", read)
+}
+
+func (c *Collector) register(name, kind string, read func() float64) {
+	c.mu.Lock()
+	c.series = append(c.series, series{name: name, kind: kind, read: read})
+	c.mu.Unlock()
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// partitionState tracks the broker high watermark alongside the offsets the
+// pool is still working on for a single partition. Workers finish batches
+// out of order and failed batches wait in the retry queue, so progress is the
+// lowest unfinished offset rather than the highest written one.
+type partitionState struct {
+	highWater atomic.Int64
+
+	mu sync.Mutex
+	// next is the offset after the newest message handed to the pool.
+	next int64
+	// inflight maps offsets handed to the pool but not yet written or
+	// dropped to their message timestamps.
+	inflight map[int64]time.Time
+	// settledTS is the timestamp of the newest message written or dropped.
+	settledTS time.Time
 }
 
 // IncProcessed increases the processed record counter.
@@ -25,18 +81,244 @@ func (c *Collector) IncErrors() {
 	c.errors.Add(1)
 }
 
+// ObserveOffsetGap records a jump of n offsets the consumer never received.
+// Aborted records, transaction markers and compaction all leave such gaps;
+// sarama drops aborted batches and markers alike before delivery, so they
+// cannot be told apart here and the series are named for skipped offsets,
+// not aborted records.
+func (c *Collector) ObserveOffsetGap(n int64) {
+	c.gapOffsets.Add(n)
+	c.gaps.Add(1)
+}
+
+// TrackPartition registers a newly claimed partition. initialOffset is the
+// first offset the claim will deliver, used as the lag baseline until the
+// first message arrives.
+func (c *Collector) TrackPartition(topic string, partition int32, initialOffset int64) {
+	state := c.partition(topic, partition)
+	if initialOffset > 0 {
+		state.mu.Lock()
+		state.next = max(state.next, initialOffset)
+		state.mu.Unlock()
+	}
+}
+
+// ForgetPartition drops lag tracking for a partition that has been revoked.
+func (c *Collector) ForgetPartition(topic string, partition int32) {
+	c.mu.Lock()
+	delete(c.partitions, partitionKey{topic: topic, partition: partition})
+	c.mu.Unlock()
+}
+
+// ObserveHighWater records the latest high watermark reported by the broker.
+func (c *Collector) ObserveHighWater(topic string, partition int32, highWater int64) {
+	if state := c.lookup(topic, partition); state != nil {
+		state.highWater.Store(highWater)
+	}
+}
+
+// ObserveReceived records that offset was handed to the pool. It must be
+// called before the pool can finish the message.
+func (c *Collector) ObserveReceived(topic string, partition int32, offset int64, ts time.Time) {
+	state := c.lookup(topic, partition)
+	if state == nil {
+		return
+	}
+	state.mu.Lock()
+	state.inflight[offset] = ts
+	state.next = max(state.next, offset+1)
+	state.mu.Unlock()
+}
+
+// ObserveWritten records that offset has been persisted. Writes for
+// partitions that are no longer tracked are ignored.
+func (c *Collector) ObserveWritten(topic string, partition int32, offset int64, ts time.Time) {
+	c.settle(topic, partition, offset, ts)
+}
+
+// ObserveDropped records that offset was given up after exhausting its
+// retries; like a write, it no longer holds the partition back.
+func (c *Collector) ObserveDropped(topic string, partition int32, offset int64, ts time.Time) {
+	c.settle(topic, partition, offset, ts)
+}
+
+func (c *Collector) settle(topic string, partition int32, offset int64, ts time.Time) {
+	state := c.lookup(topic, partition)
+	if state == nil {
+		return
+	}
+	state.mu.Lock()
+	delete(state.inflight, offset)
+	if ts.After(state.settledTS) {
+		state.settledTS = ts
+	}
+	state.mu.Unlock()
+}
+
+// progress returns the lowest offset not yet written or dropped and the
+// timestamp of the oldest message holding the partition back, if known.
+func (s *partitionState) progress(highWater int64) (int64, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	low, ts := s.next, time.Time{}
+	for offset, msgTS := range s.inflight {
+		if offset < low {
+			low, ts = offset, msgTS
+		}
+	}
+	if ts.IsZero() && highWater > low {
+		// Nothing in flight but the consumer has not caught up: the pool is
+		// as far behind as the newest message it finished.
+		ts = s.settledTS
+	}
+	return low, ts
+}
+
+func (c *Collector) lookup(topic string, partition int32) *partitionState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.partitions[partitionKey{topic: topic, partition: partition}]
+}
+
+func (c *Collector) partition(topic string, partition int32) *partitionState {
+	key := partitionKey{topic: topic, partition: partition}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if state, ok := c.partitions[key]; ok {
+		return state
+	}
+	if c.partitions == nil {
+		c.partitions = make(map[partitionKey]*partitionState)
+	}
+	state := &partitionState{inflight: make(map[int64]time.Time)}
+	c.partitions[key] = state
+	return state
+}
+
+// PartitionLag describes how far the pool trails a single partition.
+type PartitionLag struct {
+	Topic     string
+	Partition int32
+	HighWater int64
+	// WrittenOffset is the offset below which every message has been written
+	// or dropped, minus one; later offsets may already be written too.
+	WrittenOffset int64
+	Lag           int64
+	// TimeLag is the age of the oldest message still holding the partition
+	// back.
+	TimeLag time.Duration
+}
+
+// PartitionLags returns a snapshot of lag for every tracked partition, sorted
+// by topic and partition.
+func (c *Collector) PartitionLags(now time.Time) []PartitionLag {
+	c.mu.RLock()
+	lags := make([]PartitionLag, 0, len(c.partitions))
+	for key, state := range c.partitions {
+		hw := state.highWater.Load()
+		low, oldest := state.progress(hw)
+		lag := hw - low
+		if lag < 0 {
+			lag = 0
+		}
+		var timeLag time.Duration
+		if lag > 0 && !oldest.IsZero() {
+			timeLag = max(now.Sub(oldest), 0)
+		}
+		lags = append(lags, PartitionLag{
+			Topic:         key.topic,
+			Partition:     key.partition,
+			HighWater:     hw,
+			WrittenOffset: low - 1,
+			Lag:           lag,
+			TimeLag:       timeLag,
+		})
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags
+}
+
+// writeMetrics renders every series in the Prometheus text format. Samples
+// of one family must be contiguous, so each family is written in one go
+// under its TYPE line.
+func (c *Collector) writeMetrics(b *strings.Builder) {
+	counter := func(name string, value int64) {
+		fmt.Fprintf(b, "# TYPE %s counter\n%s %d\n", name, name, value)
+	}
+	counter("worker_processed_total", c.processed.Load())
+	counter("worker_errors_total", c.errors.Load())
+	counter("worker_skipped_offset_gaps_total", c.gaps.Load())
+	counter("worker_skipped_offsets_total", c.gapOffsets.Load())
+
+	c.mu.RLock()
+	registered := append([]series(nil), c.series...)
+	c.mu.RUnlock()
+	var families []string
+	byFamily := make(map[string][]series)
+	for _, s := range registered {
+		family, _, _ := strings.Cut(s.name, "{")
+		if _, ok := byFamily[family]; !ok {
+			families = append(families, family)
+		}
+		byFamily[family] = append(byFamily[family], s)
+	}
+	for _, family := range families {
+		members := byFamily[family]
+		fmt.Fprintf(b, "# TYPE %s %s\n", family, members[0].kind)
+		for _, s := range members {
+			fmt.Fprintf(b, "%s %g\n", s.name, s.read())
+		}
+	}
+
+	lags := c.PartitionLags(time.Now())
+	for _, family := range []struct {
+		name  string
+		value func(PartitionLag) string
+	}{
+		{"worker_partition_high_watermark", func(l PartitionLag) string { return strconv.FormatInt(l.HighWater, 10) }},
+		{"worker_partition_written_offset", func(l PartitionLag) string { return strconv.FormatInt(l.WrittenOffset, 10) }},
+		{"worker_partition_lag", func(l PartitionLag) string { return strconv.FormatInt(l.Lag, 10) }},
+		{"worker_partition_time_lag_seconds", func(l PartitionLag) string { return fmt.Sprintf("%.3f", l.TimeLag.Seconds()) }},
+	} {
+		if len(lags) == 0 {
+			break
+		}
+		fmt.Fprintf(b, "# TYPE %s gauge\n", family.name)
+		for _, lag := range lags {
+			fmt.Fprintf(b, "%s{topic=%q,partition=\"%d\"} %s\n", family.name, lag.Topic, lag.Partition, family.value(lag))
+		}
+	}
+}
+
+// handleMetrics serves the collector's series on /metrics.
+func (c *Collector) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var b strings.Builder
+	c.writeMetrics(&b)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// Mount registers additional handlers on the metrics server mux.
+type Mount func(mux *http.ServeMux)
+
 // Serve spins up a lightweight metrics endpoint.
-func Serve(ctx context.Context, addr string, collector *Collector) {
+func Serve(ctx context.Context, addr string, collector *Collector, mounts ...Mount) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 	})
-	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-		payload := fmt.Sprintf("worker_processed_total %d\nworker_errors_total %d\n", collector.processed.Load(), collector.errors.Load())
-		_, _ = w.Write([]byte(payload))
-	})
+	mux.HandleFunc("/metrics", collector.handleMetrics)
+	for _, mount := range mounts {
+		mount(mux)
+	}
 
 	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
 
@@ -48,6 +330,6 @@ func Serve(ctx context.Context, addr string, collector *Collector) {
 	}()
 
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("metrics server failed: %v", err)
+		slog.Error("metrics server failed", "addr", addr, "error", err)
 	}
 }
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestMetricsParseAsTextFormat(t *testing.T) {
+	c := &Collector{}
+	c.IncProcessed(3)
+	c.ObserveOffsetGap(2)
+	c.RegisterGauge("worker_batch_size", func() float64 { return 50 })
+	c.RegisterCounter(`worker_chaos_injected_total{fault="error"}`, func() float64 { return 1 })
+	c.RegisterGauge("worker_db_inflight", func() float64 { return 4 })
+	c.RegisterCounter(`worker_chaos_injected_total{fault="hang"}`, func() float64 { return 2 })
+	now := time.Now()
+	for _, p := range []int32{0, 1} {
+		c.TrackPartition("orders", p, 0)
+		c.ObserveHighWater("orders", p, 10)
+		c.ObserveReceived("orders", p, 0, now)
+	}
+
+	rec := httptest.NewRecorder()
+	c.handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(rec.Body)
+	if err != nil {
+		t.Fatalf("parse /metrics: %v\n%s", err, rec.Body)
+	}
+
+	for _, tc := range []struct {
+		family  string
+		typ     dto.MetricType
+		samples int
+	}{
+		{"worker_processed_total", dto.MetricType_COUNTER, 1},
+		{"worker_errors_total", dto.MetricType_COUNTER, 1},
+		{"worker_skipped_offset_gaps_total", dto.MetricType_COUNTER, 1},
+		{"worker_skipped_offsets_total", dto.MetricType_COUNTER, 1},
+		{"worker_batch_size", dto.MetricType_GAUGE, 1},
+		{"worker_chaos_injected_total", dto.MetricType_COUNTER, 2},
+		{"worker_partition_high_watermark", dto.MetricType_GAUGE, 2},
+		{"worker_partition_written_offset", dto.MetricType_GAUGE, 2},
+		{"worker_partition_lag", dto.MetricType_GAUGE, 2},
+		{"worker_partition_time_lag_seconds", dto.MetricType_GAUGE, 2},
+	} {
+		family, ok := families[tc.family]
+		switch {
+		case !ok:
+			t.Errorf("%s: missing", tc.family)
+		case family.GetType() != tc.typ:
+			t.Errorf("%s: want type %v, have %v", tc.family, tc.typ, family.GetType())
+		case len(family.Metric) != tc.samples:
+			t.Errorf("%s: want %d samples, have %d", tc.family, tc.samples, len(family.Metric))
+		}
+	}
+	if skipped := families["worker_skipped_offsets_total"].Metric[0].GetCounter().GetValue(); skipped != 2 {
+		t.Errorf("want 2 skipped offsets, have %g", skipped)
+	}
+	if lag := families["worker_partition_lag"].Metric[0].GetGauge().GetValue(); lag != 10 {
+		t.Errorf("want lag 10, have %g", lag)
+	}
+}
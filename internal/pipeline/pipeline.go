@@ -0,0 +1,129 @@
+// Package pipeline assembles the worker's write path from configuration:
+// the database writer, optional chaos injection, the AIMD concurrency
+// limiter and the worker pool, with their metrics. cmd/worker and the test
+// harness both build it here so they cannot drift apart.
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/IBM/sarama"
+
+	"demo/internal/chaos"
+	"demo/internal/config"
+	"demo/internal/limiter"
+	"demo/internal/metrics"
+	"demo/internal/worker"
+)
+
+// Pipeline is the assembled write path. The pool is not started.
+type Pipeline struct {
+	Pool *worker.Pool
+	// Chaos is the fault injector, nil unless CHAOS_ENABLED is set.
+	Chaos *chaos.Processor
+	// Limiter caps concurrent writes, nil when DB_CONCURRENCY_MAX is -1.
+	Limiter *limiter.AIMD
+}
+
+// New wraps writer as cfg asks (writer, then chaos, then the limiter) and
+// builds the pool around it, exporting the pool's progress and every
+// component's metrics on collector.
+func New(cfg config.Config, writer worker.Processor, collector *metrics.Collector) (*Pipeline, error) {
+	p := &Pipeline{}
+	processor := writer
+	if cfg.ChaosEnabled {
+		faults, err := chaos.NewProcessor(writer, Faults(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("init chaos: %w", err)
+		}
+		slog.Warn("chaos fault injection enabled; do not run this in production")
+		for _, kind := range []struct {
+			label string
+			read  func(chaos.Stats) int64
+		}{
+			{"error", func(s chaos.Stats) int64 { return s.Errors }},
+			{"partial", func(s chaos.Stats) int64 { return s.Partials }},
+			{"hang", func(s chaos.Stats) int64 { return s.Hangs }},
+			{"delay", func(s chaos.Stats) int64 { return s.Delayed }},
+		} {
+			kind := kind
+			collector.RegisterCounter(fmt.Sprintf("worker_chaos_injected_total{fault=%q}", kind.label), func() float64 {
+				return float64(kind.read(faults.Stats()))
+			})
+		}
+		p.Chaos = faults
+		processor = faults
+	}
+	// The limiter goes outermost so injected faults and latency count
+	// against it exactly like real database trouble would.
+	if cfg.DBConcurrencyMax >= 0 {
+		maxConcurrency := cfg.DBConcurrencyMax
+		if maxConcurrency == 0 {
+			maxConcurrency = int(cfg.DBMaxConns)
+		}
+		aimd := limiter.New(limiter.Options{
+			Initial:          cfg.DBConcurrencyInitial,
+			Min:              cfg.DBConcurrencyMin,
+			Max:              maxConcurrency,
+			LatencyThreshold: cfg.DBLatencyThreshold,
+		})
+		collector.RegisterGauge("worker_db_concurrency_limit", func() float64 { return float64(aimd.Limit()) })
+		collector.RegisterGauge("worker_db_inflight", func() float64 { return float64(aimd.InFlight()) })
+		collector.RegisterGauge("worker_db_waiting", func() float64 { return float64(aimd.Waiting()) })
+		p.Limiter = aimd
+		processor = limiter.NewProcessor(processor, aimd)
+	}
+
+	p.Pool = worker.NewPool(processor, worker.Options{
+		WorkerCount: cfg.WorkerCount,
+		JobBuffer:   cfg.JobBuffer,
+		BatchSize:   cfg.BatchSize,
+		FlushEvery:  cfg.BatchFlushInterval,
+		MaxRetries:  cfg.MaxRetries,
+
+		RetryCapacity:    cfg.RetryCapacity,
+		RetryBaseDelay:   cfg.RetryBaseDelay,
+		RetryMaxDelay:    cfg.RetryMaxDelay,
+		MaxBufferedBytes: int64(cfg.MaxBufferedBytes),
+
+		BatchLatencyTarget: cfg.BatchTargetLatency,
+		MinBatchSize:       cfg.BatchSizeMin,
+		MaxBatchSize:       cfg.BatchSizeMax,
+
+		OnError: func(error) {
+			collector.IncErrors()
+		},
+		OnSuccess: collector.IncProcessed,
+		OnWritten: func(records []worker.Record) {
+			for _, rec := range records {
+				collector.ObserveWritten(rec.Topic, rec.Partition, rec.Offset, rec.Timestamp)
+			}
+		},
+		OnDropped: func(msg *sarama.ConsumerMessage) {
+			collector.ObserveDropped(msg.Topic, msg.Partition, msg.Offset, msg.Timestamp)
+		},
+	})
+
+	pool := p.Pool
+	collector.RegisterGauge("worker_batch_size", func() float64 { return float64(pool.BatchSize()) })
+	collector.RegisterGauge("worker_buffered_bytes", func() float64 { return float64(pool.Stats().BufferedBytes) })
+	collector.RegisterGauge("worker_buffered_bytes_limit", func() float64 { return float64(cfg.MaxBufferedBytes) })
+	collector.RegisterGauge("worker_retry_backlog", func() float64 { return float64(pool.Stats().RetryBacklog) })
+	collector.RegisterGauge("worker_retry_capacity", func() float64 { return float64(cfg.RetryCapacity) })
+	return p, nil
+}
+
+// Faults maps the CHAOS_* settings onto the faults injected at startup.
+func Faults(cfg config.Config) chaos.Faults {
+	return chaos.Faults{
+		ErrorRate:     cfg.ChaosErrorRate,
+		PartialRate:   cfg.ChaosPartialRate,
+		HangRate:      cfg.ChaosHangRate,
+		SQLState:      cfg.ChaosSQLState,
+		Latency:       cfg.ChaosLatency,
+		LatencyJitter: cfg.ChaosLatencyJitter,
+		SlowRate:      cfg.ChaosSlowRate,
+		SlowLatency:   cfg.ChaosSlowLatency,
+	}
+}
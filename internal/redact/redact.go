@@ -0,0 +1,28 @@
+package redact
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Value replaces a secret.
+const Value = "xxxxx"
+
+var dsnPassword = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// DSN masks the password in both URL and key=value connection strings.
+func DSN(dsn string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsnPassword.ReplaceAllString(dsn, "${1}"+Value)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return Value
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", Value)
+		u.RawQuery = q.Encode()
+	}
+	return u.Redacted()
+}
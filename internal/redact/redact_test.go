@@ -0,0 +1,21 @@
+package redact
+
+import "testing"
+
+func TestDSN(t *testing.T) {
+	for _, tc := range []struct {
+		dsn, want string
+	}{
+		{"postgres://app:secret@db:5432/events", "postgres://app:xxxxx@db:5432/events"},
+		{"postgres://db/events?password=secret&sslmode=disable", "postgres://db/events?password=xxxxx&sslmode=disable"},
+		{"postgres://db/events", "postgres://db/events"},
+		{"host=db user=app password=secret dbname=events", "host=db user=app password=xxxxx dbname=events"},
+		{"host=db PASSWORD = 'two words' dbname=events", "host=db PASSWORD = xxxxx dbname=events"},
+		{"http://[::1", Value},
+		{"", ""},
+	} {
+		if have := DSN(tc.dsn); have != tc.want {
+			t.Errorf("%q: want %q, have %q", tc.dsn, tc.want, have)
+		}
+	}
+}
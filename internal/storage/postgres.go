@@ -3,16 +3,25 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
 
 	"demo/internal/worker"
 )
 
+var tracer = otel.Tracer("demo/internal/storage")
+
 // PostgresWriter persists Kafka records into a Postgres table using batched inserts.
 type PostgresWriter struct {
 	pool      *pgxpool.Pool
@@ -47,13 +56,39 @@ func (w *PostgresWriter) Close() {
 	w.pool.Close()
 }
 
+// Ping verifies a connection can be acquired and round-trips to the server.
+func (w *PostgresWriter) Ping(ctx context.Context) error {
+	return w.pool.Ping(ctx)
+}
+
 // ProcessBatch implements worker.Processor and writes messages to Postgres.
-func (w *PostgresWriter) ProcessBatch(ctx context.Context, records []worker.Record) error {
+func (w *PostgresWriter) ProcessBatch(ctx context.Context, records []worker.Record) (err error) {
 	if len(records) == 0 {
 		return nil
 	}
+
+	ctx, span := tracer.Start(ctx, "postgres.write",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBSQLTable(w.tableName),
+			attribute.Int("db.rows", len(records)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				span.SetAttributes(attribute.String("db.postgresql.sqlstate", pgErr.Code))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	batch := &pgx.Batch{}
-	quoted := quoteIdentifier(w.tableName)
+	quoted := QuoteIdentifier(w.tableName)
 	query := fmt.Sprintf(`INSERT INTO %s (topic, partition, message_offset, key, value, headers, event_time)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (topic, partition, message_offset) DO NOTHING`, quoted)
@@ -74,6 +109,7 @@ func (w *PostgresWriter) ProcessBatch(ctx context.Context, records []worker.Reco
 	return nil
 }
 
-func quoteIdentifier(id string) string {
+// QuoteIdentifier quotes a table name for use in SQL text.
+func QuoteIdentifier(id string) string {
 	return `"` + strings.ReplaceAll(id, `"`, `""`) + `"`
 }
@@ -0,0 +1,263 @@
+package testharness
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// KafkaVersion is the protocol version the mock broker speaks. Response
+	// versions built by hand below must match what sarama sends for it.
+	KafkaVersion = "2.1.0"
+
+	heartbeatVersion = 2
+	fetchBatchSize   = 100
+	memberID         = "harness-member"
+)
+
+// T is the part of testing.TB the harness relies on.
+type T interface {
+	sarama.TestReporter
+	Cleanup(func())
+}
+
+// Cluster is a single sarama MockBroker acting as the whole Kafka cluster for
+// one topic and one consumer group. This process is the only group member and
+// is assigned the partitions chosen with Assign.
+//
+// MockBroker only serves canned responses, so every change (produced
+// messages, commits, assignment) rebuilds the full handler set. Commits are
+// read back from the broker's request history, which lets a new session pick
+// up from the last committed offset like a real coordinator would.
+type Cluster struct {
+	t          T
+	broker     *sarama.MockBroker
+	topic      string
+	group      string
+	partitions int32
+
+	mu         sync.Mutex
+	log        map[int32][]message
+	committed  map[int32]int64
+	assigned   []int32
+	generation int32
+	heartbeat  sarama.MockResponse
+	scanned    int
+
+	requests chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+type message struct {
+	key, value []byte
+}
+
+// NewCluster starts a mock broker serving topic with the given number of
+// partitions, all assigned to the local member and committed at offset 0.
+func NewCluster(t T, topic, group string, partitions int32) *Cluster {
+	t.Helper()
+	c := &Cluster{
+		t:          t,
+		broker:     sarama.NewMockBroker(t, 1),
+		topic:      topic,
+		group:      group,
+		partitions: partitions,
+		log:        make(map[int32][]message),
+		committed:  make(map[int32]int64),
+		generation: 1,
+		heartbeat:  sarama.NewMockWrapper(&sarama.HeartbeatResponse{Version: heartbeatVersion}),
+		requests:   make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	for p := int32(0); p < partitions; p++ {
+		c.assigned = append(c.assigned, p)
+	}
+	// The notifier runs under the broker's lock, so it only signals; handlers
+	// are swapped from a separate goroutine.
+	c.broker.SetLatency(2 * time.Millisecond)
+	c.broker.SetNotifier(func(int, int) {
+		select {
+		case c.requests <- struct{}{}:
+		default:
+		}
+	})
+	c.mu.Lock()
+	c.refreshLocked()
+	c.mu.Unlock()
+	go c.watchCommits()
+	t.Cleanup(c.Close)
+	return c
+}
+
+// Addr is the bootstrap address of the mock broker.
+func (c *Cluster) Addr() string {
+	return c.broker.Addr()
+}
+
+// Topic is the topic served by the cluster.
+func (c *Cluster) Topic() string {
+	return c.topic
+}
+
+// Close stops the broker. It is registered as a cleanup by NewCluster.
+func (c *Cluster) Close() {
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	close(c.done)
+	<-c.stopped
+	c.broker.Close()
+}
+
+// Produce appends values to a partition and returns the offset of the first
+// one. Keys are left empty.
+func (c *Cluster) Produce(partition int32, values ...[]byte) int64 {
+	msgs := make([]message, len(values))
+	for i, v := range values {
+		msgs[i] = message{value: v}
+	}
+	return c.append(partition, msgs)
+}
+
+// ProduceKeyed appends a single keyed message and returns its offset.
+func (c *Cluster) ProduceKeyed(partition int32, key, value []byte) int64 {
+	return c.append(partition, []message{{key: key, value: value}})
+}
+
+func (c *Cluster) append(partition int32, msgs []message) int64 {
+	c.t.Helper()
+	if partition < 0 || partition >= c.partitions {
+		c.t.Fatalf("partition %d out of range [0,%d)", partition, c.partitions)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first := int64(len(c.log[partition]))
+	c.log[partition] = append(c.log[partition], msgs...)
+	c.refreshLocked()
+	return first
+}
+
+// HighWaterMark is the offset the next message produced to partition gets.
+func (c *Cluster) HighWaterMark(partition int32) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.log[partition]))
+}
+
+// Committed is the last offset the group committed for partition, i.e. the
+// next offset a new session would read.
+func (c *Cluster) Committed(partition int32) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scanCommitsLocked()
+	return c.committed[partition]
+}
+
+// Assign triggers a rebalance after which the local member owns exactly the
+// given partitions. The running session fails its next heartbeat, commits
+// what it marked, and rejoins with the new assignment.
+func (c *Cluster) Assign(partitions ...int32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assigned = append([]int32(nil), partitions...)
+	sort.Slice(c.assigned, func(i, j int) bool { return c.assigned[i] < c.assigned[j] })
+	c.generation++
+	c.heartbeat = sarama.NewMockSequence(
+		&sarama.HeartbeatResponse{Version: heartbeatVersion, Err: sarama.ErrRebalanceInProgress},
+		&sarama.HeartbeatResponse{Version: heartbeatVersion},
+	)
+	c.refreshLocked()
+}
+
+// watchCommits folds offset commits seen by the broker back into the
+// OffsetFetch response.
+func (c *Cluster) watchCommits() {
+	defer close(c.stopped)
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.requests:
+		}
+		c.mu.Lock()
+		if c.scanCommitsLocked() {
+			c.refreshLocked()
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Cluster) scanCommitsLocked() bool {
+	history := c.broker.History()
+	changed := false
+	for _, rr := range history[c.scanned:] {
+		req, ok := rr.Request.(*sarama.OffsetCommitRequest)
+		if !ok || req.ConsumerGroup != c.group {
+			continue
+		}
+		for p := int32(0); p < c.partitions; p++ {
+			if offset, _, err := req.Offset(c.topic, p); err == nil {
+				c.committed[p] = offset
+				changed = true
+			}
+		}
+	}
+	c.scanned = len(history)
+	return changed
+}
+
+func (c *Cluster) refreshLocked() {
+	id := c.broker.BrokerID()
+	metadata := sarama.NewMockMetadataResponse(c.t).
+		SetBroker(c.broker.Addr(), id).
+		SetController(id)
+	offsets := sarama.NewMockOffsetResponse(c.t)
+	fetch := sarama.NewMockFetchResponse(c.t, fetchBatchSize)
+	offsetFetch := sarama.NewMockOffsetFetchResponse(c.t)
+
+	for p := int32(0); p < c.partitions; p++ {
+		hw := int64(len(c.log[p]))
+		metadata.SetLeader(c.topic, p, id)
+		offsets.SetOffset(c.topic, p, sarama.OffsetOldest, 0).
+			SetOffset(c.topic, p, sarama.OffsetNewest, hw)
+		for offset, msg := range c.log[p] {
+			var key sarama.Encoder
+			if msg.key != nil {
+				key = sarama.ByteEncoder(msg.key)
+			}
+			fetch.SetMessageWithKey(c.topic, p, int64(offset), key, sarama.ByteEncoder(msg.value))
+		}
+		fetch.SetHighWaterMark(c.topic, p, hw)
+		offsetFetch.SetOffset(c.group, c.topic, p, c.committed[p], "", sarama.ErrNoError)
+	}
+
+	assignment := &sarama.ConsumerGroupMemberAssignment{
+		Topics: map[string][]int32{c.topic: c.assigned},
+	}
+	c.broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": metadata,
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(c.t).
+			SetCoordinator(sarama.CoordinatorGroup, c.group, c.broker),
+		// A follower takes its assignment from SyncGroup as is, so the
+		// member never has to compute a plan.
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(c.t).
+			SetGroupProtocol(sarama.BalanceStrategyRange.Name()).
+			SetGenerationId(c.generation).
+			SetMemberId(memberID).
+			SetLeaderId("harness-leader"),
+		"SyncGroupRequest":    sarama.NewMockSyncGroupResponse(c.t).SetMemberAssignment(assignment),
+		"HeartbeatRequest":    c.heartbeat,
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(c.t),
+		"OffsetFetchRequest":  offsetFetch,
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(c.t),
+		"OffsetRequest":       offsets,
+		"FetchRequest":        fetch,
+	})
+}
@@ -0,0 +1,219 @@
+package testharness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"demo/internal/chaos"
+	"demo/internal/config"
+	"demo/internal/consumer"
+	"demo/internal/limiter"
+	"demo/internal/metrics"
+	"demo/internal/pipeline"
+	"demo/internal/worker"
+)
+
+// DefaultTimeout bounds the Wait helpers.
+const DefaultTimeout = 10 * time.Second
+
+// Options describe the pipeline under test.
+type Options struct {
+	// Partitions of the test topic; defaults to 1.
+	Partitions int32
+	// Configure adjusts the worker configuration before the pool and runner
+	// are built. Kafka settings are pointed at the mock broker beforehand.
+	Configure func(*config.Config)
+	// Wrap decorates the store before the pipeline wraps it further, e.g.
+	// to observe the batches that reach storage.
+	Wrap func(worker.Processor) worker.Processor
+}
+
+// Harness runs the real consumer.Runner and worker.Pool against a mock Kafka
+// cluster and an in-memory Store, wired by the same pipeline.New as
+// cmd/worker.
+// Everything is torn down through t.Cleanup.
+type Harness struct {
+	t         T
+	Config    config.Config
+	Cluster   *Cluster
+	Store     *Store
+	Collector *metrics.Collector
+	Pool      *worker.Pool
+	Runner    *consumer.Runner
+	// Chaos is the pipeline's fault injector when Configure enables chaos.
+	Chaos *chaos.Processor
+	// Limiter is the pipeline's AIMD limiter unless Configure disables it.
+	Limiter *limiter.AIMD
+
+	stopConsuming context.CancelFunc
+	runDone       chan error
+	shutdown      bool
+}
+
+// New starts a harness and begins consuming.
+func New(t T, opts Options) *Harness {
+	t.Helper()
+	if opts.Partitions <= 0 {
+		opts.Partitions = 1
+	}
+
+	cfg := config.Defaults()
+	cfg.KafkaTopic = "harness.events"
+	cfg.KafkaGroup = "harness"
+	cfg.KafkaVersion = KafkaVersion
+	cfg.KafkaHeartbeat = 50 * time.Millisecond
+	cfg.KafkaSessionTimeout = time.Second
+	cfg.WorkerCount = 2
+	cfg.BatchSize = 10
+	cfg.BatchFlushInterval = 10 * time.Millisecond
+	cfg.RetryBaseDelay = 10 * time.Millisecond
+	cfg.RetryMaxDelay = 50 * time.Millisecond
+	cfg.ShutdownGracePeriod = 5 * time.Second
+	if opts.Configure != nil {
+		opts.Configure(&cfg)
+	}
+
+	h := &Harness{
+		t:         t,
+		Cluster:   NewCluster(t, cfg.KafkaTopic, cfg.KafkaGroup, opts.Partitions),
+		Store:     NewStore(),
+		Collector: &metrics.Collector{},
+		runDone:   make(chan error, 1),
+	}
+	cfg.KafkaBrokers = []string{h.Cluster.Addr()}
+	h.Config = cfg
+
+	var processor worker.Processor = h.Store
+	if opts.Wrap != nil {
+		processor = opts.Wrap(processor)
+	}
+	pipe, err := pipeline.New(cfg, processor, h.Collector)
+	if err != nil {
+		t.Fatalf("build pipeline: %v", err)
+	}
+	h.Pool, h.Chaos, h.Limiter = pipe.Pool, pipe.Chaos, pipe.Limiter
+	h.Pool.Start(context.Background())
+
+	runner, err := consumer.NewRunner(context.Background(), cfg, h.Pool, h.Collector)
+	if err != nil {
+		h.Pool.Stop()
+		t.Fatalf("create runner: %v", err)
+	}
+	h.Runner = runner
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.stopConsuming = cancel
+	go func() { h.runDone <- runner.Run(ctx) }()
+
+	t.Cleanup(func() { h.Shutdown() })
+	return h
+}
+
+// Topic is the topic consumed by the harness.
+func (h *Harness) Topic() string {
+	return h.Config.KafkaTopic
+}
+
+// ProduceN appends n messages to partition with values "p<partition>-<offset>"
+// and returns the offset of the first one.
+func (h *Harness) ProduceN(partition int32, n int) int64 {
+	first := h.Cluster.HighWaterMark(partition)
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("p%d-%d", partition, first+int64(i)))
+	}
+	return h.Cluster.Produce(partition, values...)
+}
+
+// Eventually polls cond until it holds, failing the test after timeout.
+func (h *Harness) Eventually(timeout time.Duration, cond func() bool, format string, args ...any) {
+	h.t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			h.t.Fatalf("timed out after %s: "+format, append([]any{timeout}, args...)...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitWritten waits until the store holds at least n distinct rows.
+func (h *Harness) WaitWritten(n int) {
+	h.t.Helper()
+	h.Eventually(DefaultTimeout, func() bool { return h.Store.Len() >= n },
+		"want %d rows written, have %d", n, h.Store.Len())
+}
+
+// WaitCommitted waits until the group has committed offset for partition.
+func (h *Harness) WaitCommitted(partition int32, offset int64) {
+	h.t.Helper()
+	h.Eventually(DefaultTimeout, func() bool { return h.Cluster.Committed(partition) >= offset },
+		"want partition %d committed at %d, have %d", partition, offset, h.Cluster.Committed(partition))
+}
+
+// WaitAssigned waits until the runner holds exactly the given number of
+// partitions, e.g. after Cluster.Assign.
+func (h *Harness) WaitAssigned(n int) {
+	h.t.Helper()
+	h.Eventually(DefaultTimeout, func() bool { return len(h.Runner.Assignments()) == n },
+		"want %d partitions assigned, have %d", n, len(h.Runner.Assignments()))
+}
+
+// AssertRows fails the test unless partition holds exactly the offsets
+// [from, to) and nothing else.
+func (h *Harness) AssertRows(partition int32, from, to int64) {
+	h.t.Helper()
+	got := h.Store.Offsets(h.Topic(), partition)
+	if int64(len(got)) != to-from {
+		h.t.Errorf("partition %d: want offsets [%d,%d), have %d rows: %v", partition, from, to, len(got), got)
+		return
+	}
+	for i, offset := range got {
+		if offset != from+int64(i) {
+			h.t.Errorf("partition %d: want offsets [%d,%d), have %v", partition, from, to, got)
+			return
+		}
+	}
+}
+
+// AssertCommitted fails the test unless partition's committed offset is
+// exactly offset.
+func (h *Harness) AssertCommitted(partition int32, offset int64) {
+	h.t.Helper()
+	if got := h.Cluster.Committed(partition); got != offset {
+		h.t.Errorf("partition %d: want committed offset %d, have %d", partition, offset, got)
+	}
+}
+
+// Shutdown runs the worker's shutdown sequence within the configured grace
+// period: stop fetching, drain the pool, commit, then leave the group. It is
+// safe to call more than once; later calls return an empty report.
+func (h *Harness) Shutdown() worker.DrainReport {
+	h.t.Helper()
+	if h.shutdown {
+		return worker.DrainReport{}
+	}
+	h.shutdown = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.Config.ShutdownGracePeriod)
+	defer cancel()
+
+	h.Runner.StopFetching()
+	report := h.Pool.Drain(ctx)
+	h.Runner.Commit()
+	h.stopConsuming()
+	select {
+	case err := <-h.runDone:
+		if err != nil && !errors.Is(err, context.Canceled) {
+			h.t.Errorf("runner: %v", err)
+		}
+	case <-ctx.Done():
+		h.t.Errorf("consumer group session did not end within %s", h.Config.ShutdownGracePeriod)
+	}
+	if err := h.Runner.Close(); err != nil {
+		h.t.Errorf("close runner: %v", err)
+	}
+	return report
+}
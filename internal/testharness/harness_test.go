@@ -0,0 +1,129 @@
+package testharness
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"demo/internal/chaos"
+	"demo/internal/config"
+)
+
+func TestFailedBatchesAreRetried(t *testing.T) {
+	h := New(t, Options{})
+	h.Store.FailNext(errors.New("connection reset"), errors.New("connection reset"))
+
+	h.ProduceN(0, 20)
+	h.WaitWritten(20)
+	h.WaitCommitted(0, 20)
+
+	h.AssertRows(0, 0, 20)
+	if attempts, batches := h.Store.Attempts(), h.Store.Batches(); attempts < batches+2 {
+		t.Errorf("want at least 2 failed attempts, have %d attempts for %d batches", attempts, batches)
+	}
+}
+
+func TestRebalanceHandsPartitionsOver(t *testing.T) {
+	h := New(t, Options{Partitions: 2})
+	h.ProduceN(0, 10)
+	h.ProduceN(1, 10)
+	h.WaitWritten(20)
+	h.WaitCommitted(0, 10)
+	h.WaitCommitted(1, 10)
+
+	// Lose partition 0: new messages there must wait for its next owner.
+	h.Cluster.Assign(1)
+	h.WaitAssigned(1)
+	h.ProduceN(0, 5)
+	h.ProduceN(1, 5)
+	h.Eventually(DefaultTimeout, func() bool { return len(h.Store.Offsets(h.Topic(), 1)) == 15 },
+		"want 15 rows in partition 1, have %d", len(h.Store.Offsets(h.Topic(), 1)))
+	time.Sleep(100 * time.Millisecond)
+	h.AssertRows(0, 0, 10)
+	h.AssertCommitted(0, 10)
+
+	// Get it back: consumption resumes from the committed offset.
+	h.Cluster.Assign(0, 1)
+	h.WaitAssigned(2)
+	h.WaitWritten(30)
+	h.WaitCommitted(0, 15)
+	h.WaitCommitted(1, 15)
+	h.AssertRows(0, 0, 15)
+	h.AssertRows(1, 0, 15)
+}
+
+func TestShutdownCommitsOnlyWrittenOffsets(t *testing.T) {
+	h := New(t, Options{})
+	h.Store.SetLatency(50 * time.Millisecond)
+	h.ProduceN(0, 100)
+	h.Eventually(DefaultTimeout, func() bool { return h.Store.Batches() > 0 },
+		"want a batch written before shutdown")
+
+	report := h.Shutdown()
+	if report.TimedOut {
+		t.Fatalf("drain timed out: %+v", report)
+	}
+
+	committed := h.Cluster.Committed(0)
+	if committed == 0 {
+		t.Fatalf("nothing committed after %d rows were written", h.Store.Len())
+	}
+	for offset := int64(0); offset < committed; offset++ {
+		if !h.Store.Has(h.Topic(), 0, offset) {
+			t.Fatalf("offset %d committed (at %d) but never written", offset, committed)
+		}
+	}
+}
+
+func TestChaosFailuresReachPoolBehindLimiter(t *testing.T) {
+	h := New(t, Options{Configure: func(cfg *config.Config) {
+		cfg.ChaosEnabled = true
+		cfg.ChaosErrorRate = 1
+	}})
+	if h.Limiter == nil {
+		t.Fatal("limiter disabled by default config")
+	}
+	initial := h.Limiter.Limit()
+
+	h.ProduceN(0, 10)
+	h.Eventually(DefaultTimeout, func() bool { return h.Chaos.Stats().Errors >= 3 },
+		"want injected errors, have %+v", h.Chaos.Stats())
+	if n := h.Store.Len(); n != 0 {
+		t.Fatalf("want no rows while every batch fails, have %d", n)
+	}
+	if limit := h.Limiter.Limit(); limit >= initial {
+		t.Errorf("want injected connection errors to cut the limit below %d, have %d", initial, limit)
+	}
+
+	// The failed batches sit in the pool's retry queue and land once the
+	// faults are lifted.
+	if err := h.Chaos.Set(chaos.Faults{}); err != nil {
+		t.Fatalf("clear faults: %v", err)
+	}
+	h.WaitWritten(10)
+	h.WaitCommitted(0, 10)
+	h.AssertRows(0, 0, 10)
+}
+
+func TestChaosHangReleasedByFaultUpdate(t *testing.T) {
+	h := New(t, Options{Configure: func(cfg *config.Config) {
+		cfg.ChaosEnabled = true
+		cfg.ChaosHangRate = 1
+	}})
+
+	h.ProduceN(0, 10)
+	h.Eventually(DefaultTimeout, func() bool { return h.Chaos.Stats().Hangs >= 1 },
+		"want a hung batch, have %+v", h.Chaos.Stats())
+	time.Sleep(50 * time.Millisecond)
+	if n := h.Store.Len(); n != 0 {
+		t.Fatalf("want no rows while batches hang, have %d", n)
+	}
+
+	// Clearing the faults must release the hung batches without a shutdown.
+	if err := h.Chaos.Set(chaos.Faults{}); err != nil {
+		t.Fatalf("clear faults: %v", err)
+	}
+	h.WaitWritten(10)
+	h.WaitCommitted(0, 10)
+	h.AssertRows(0, 0, 10)
+}
@@ -0,0 +1,162 @@
+package testharness
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"demo/internal/worker"
+)
+
+// Store is an in-memory stand-in for the Postgres table. Like the real
+// writer, each batch is applied atomically and rows are keyed by topic,
+// partition and offset, so redelivered records are ignored rather than
+// duplicated.
+type Store struct {
+	mu       sync.Mutex
+	rows     map[rowKey]worker.Record
+	batches  int
+	attempts int
+	fail     []error
+	failWhen func([]worker.Record) error
+	latency  time.Duration
+}
+
+type rowKey struct {
+	topic     string
+	partition int32
+	offset    int64
+}
+
+// NewStore returns an empty store.
+func NewStore() *Store {
+	return &Store{rows: make(map[rowKey]worker.Record)}
+}
+
+// ProcessBatch implements worker.Processor.
+func (s *Store) ProcessBatch(ctx context.Context, records []worker.Record) error {
+	s.mu.Lock()
+	s.attempts++
+	latency := s.latency
+	var err error
+	if len(s.fail) > 0 {
+		err, s.fail = s.fail[0], s.fail[1:]
+	} else if s.failWhen != nil {
+		err = s.failWhen(records)
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	for _, rec := range records {
+		key := rowKey{rec.Topic, rec.Partition, rec.Offset}
+		if _, ok := s.rows[key]; !ok {
+			s.rows[key] = rec
+		}
+	}
+	return nil
+}
+
+// FailNext makes the next batches fail with the given errors, in order.
+func (s *Store) FailNext(errs ...error) {
+	s.mu.Lock()
+	s.fail = append(s.fail, errs...)
+	s.mu.Unlock()
+}
+
+// FailWhen fails every batch for which fn returns an error, once FailNext
+// errors are used up. A nil fn clears it.
+func (s *Store) FailWhen(fn func([]worker.Record) error) {
+	s.mu.Lock()
+	s.failWhen = fn
+	s.mu.Unlock()
+}
+
+// SetLatency delays every write by d, or until the write's context ends.
+func (s *Store) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	s.latency = d
+	s.mu.Unlock()
+}
+
+// Len is the number of distinct rows written.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.rows)
+}
+
+// Has reports whether the record at the given position was written.
+func (s *Store) Has(topic string, partition int32, offset int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.rows[rowKey{topic, partition, offset}]
+	return ok
+}
+
+// Offsets lists the written offsets of a partition in ascending order.
+func (s *Store) Offsets(topic string, partition int32) []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var offsets []int64
+	for key := range s.rows {
+		if key.topic == topic && key.partition == partition {
+			offsets = append(offsets, key.offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// Rows returns every written record ordered by partition and offset.
+func (s *Store) Rows() []worker.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := make([]worker.Record, 0, len(s.rows))
+	for _, rec := range s.rows {
+		rows = append(rows, rec)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Topic != rows[j].Topic {
+			return rows[i].Topic < rows[j].Topic
+		}
+		if rows[i].Partition != rows[j].Partition {
+			return rows[i].Partition < rows[j].Partition
+		}
+		return rows[i].Offset < rows[j].Offset
+	})
+	return rows
+}
+
+// Attempts counts ProcessBatch calls, failed ones included; Batches counts
+// only the ones that were applied.
+func (s *Store) Attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts
+}
+
+// Batches counts applied batches.
+func (s *Store) Batches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Supported values for the exporter setting.
+const (
+	ExporterNone     = "none"
+	ExporterStdout   = "stdout"
+	ExporterOTLPGRPC = "otlpgrpc"
+	ExporterOTLPHTTP = "otlphttp"
+)
+
+// Setup installs the global tracer provider and W3C propagator. OTLP endpoints,
+// headers and TLS settings come from the standard OTEL_EXPORTER_OTLP_* variables.
+// The returned function flushes pending spans and must be called on shutdown.
+func Setup(ctx context.Context, exporter, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var (
+		spanExporter sdktrace.SpanExporter
+		err          error
+	)
+	switch strings.ToLower(exporter) {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterOTLPGRPC:
+		spanExporter, err = otlptracegrpc.New(ctx)
+	case ExporterOTLPHTTP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// HeaderCarrier adapts decoded Kafka headers to a propagation.TextMapCarrier.
+type HeaderCarrier map[string][]byte
+
+// Get returns the value for key, matching case-insensitively as producers
+// are inconsistent about header casing.
+func (c HeaderCarrier) Get(key string) string {
+	if v, ok := c[key]; ok {
+		return string(v)
+	}
+	for k, v := range c {
+		if strings.EqualFold(k, key) {
+			return string(v)
+		}
+	}
+	return ""
+}
+
+// Set stores a header value.
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = []byte(value)
+}
+
+// Keys lists the header names present.
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,130 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencyEWMAWeight is how much each new batch moves the smoothed latency.
+	latencyEWMAWeight = 0.2
+	// growHeadroom keeps growth off until latency is comfortably under target.
+	growHeadroom = 0.8
+	// shrinkFactor is applied to the batch size when latency exceeds target.
+	shrinkFactor = 0.75
+	// settleTargets is how many target latencies must pass between
+	// adjustments, so batches built at the new size get measured before the
+	// next change instead of every concurrent worker compounding one signal.
+	settleTargets = 4
+)
+
+type queuedKey struct{}
+
+// withQueueTimer returns a context through which processor wrappers report
+// time spent waiting before the write starts.
+func withQueueTimer(ctx context.Context) (context.Context, *atomic.Int64) {
+	queued := new(atomic.Int64)
+	return context.WithValue(ctx, queuedKey{}, queued), queued
+}
+
+// ObserveQueued lets a Processor wrapper report that a batch waited d before
+// its write started, e.g. for a concurrency slot, so adaptive batch sizing
+// reacts to write latency rather than queueing.
+func ObserveQueued(ctx context.Context, d time.Duration) {
+	if queued, ok := ctx.Value(queuedKey{}).(*atomic.Int64); ok {
+		queued.Add(int64(d))
+	}
+}
+
+// batchController adapts the batch size to keep per-batch write latency near
+// a target: additive growth while latency is under target and batches fill
+// up, multiplicative shrink when latency climbs, halving on errors.
+type batchController struct {
+	mu     sync.Mutex
+	target time.Duration
+	min    int
+	max    int
+	ewma   float64
+	last   time.Time
+	size   atomic.Int64
+}
+
+func newBatchController(target time.Duration, initial, min, max int) *batchController {
+	if min <= 0 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	c := &batchController{target: target, min: min, max: max}
+	c.reset(initial)
+	return c
+}
+
+// current returns the batch size workers should flush at.
+func (c *batchController) current() int {
+	return int(c.size.Load())
+}
+
+// reset moves the controller to size (clamped) and forgets latency history,
+// used when an operator sets a new batch size.
+func (c *batchController) reset(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ewma = 0
+	c.size.Store(int64(c.clamp(size)))
+}
+
+// observe feeds the outcome of one flushed batch into the controller.
+func (c *batchController) observe(records int, latency time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !failed {
+		sample := float64(latency)
+		if c.ewma == 0 {
+			c.ewma = sample
+		} else {
+			c.ewma += latencyEWMAWeight * (sample - c.ewma)
+		}
+	}
+
+	now := time.Now()
+	if now.Sub(c.last) < settleTargets*c.target {
+		return
+	}
+
+	size := int(c.size.Load())
+	next := size
+	target := float64(c.target)
+	switch {
+	case failed:
+		next = size / 2
+	case c.ewma > target:
+		next = int(float64(size) * shrinkFactor)
+	case c.ewma < target*growHeadroom && records >= size:
+		// Only grow on full batches; timer-driven partial flushes say nothing
+		// about how a larger batch would perform.
+		step := size / 10
+		if step < 1 {
+			step = 1
+		}
+		next = size + step
+	}
+	if next = c.clamp(next); next != size {
+		c.size.Store(int64(next))
+		c.last = now
+	}
+}
+
+func (c *batchController) clamp(size int) int {
+	if size < c.min {
+		return c.min
+	}
+	if size > c.max {
+		return c.max
+	}
+	return size
+}
@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBatchControllerAdjusts(t *testing.T) {
+	target := 100 * time.Millisecond
+	for _, tc := range []struct {
+		name    string
+		initial int
+		records int
+		latency time.Duration
+		failed  bool
+		want    int
+	}{
+		{name: "fast full batch grows by a tenth", initial: 100, records: 100, latency: 10 * time.Millisecond, want: 110},
+		{name: "small batch grows by one", initial: 12, records: 12, latency: 10 * time.Millisecond, want: 13},
+		{name: "fast partial batch holds", initial: 100, records: 40, latency: 10 * time.Millisecond, want: 100},
+		{name: "near target holds", initial: 100, records: 100, latency: 90 * time.Millisecond, want: 100},
+		{name: "slow batch shrinks", initial: 100, records: 100, latency: 200 * time.Millisecond, want: 75},
+		{name: "failure halves", initial: 100, records: 100, failed: true, want: 50},
+		{name: "growth capped at max", initial: 500, records: 500, latency: 10 * time.Millisecond, want: 500},
+		{name: "shrink floored at min", initial: 12, records: 12, failed: true, want: 10},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := newBatchController(target, tc.initial, 10, 500)
+			c.observe(tc.records, tc.latency, tc.failed)
+			if got := c.current(); got != tc.want {
+				t.Errorf("want batch size %d, have %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBatchControllerSettlesBetweenChanges(t *testing.T) {
+	c := newBatchController(time.Hour, 100, 10, 500)
+	c.observe(100, time.Minute, false)
+	if got := c.current(); got != 110 {
+		t.Fatalf("want first observation to grow to 110, have %d", got)
+	}
+	c.observe(110, time.Minute, false)
+	c.observe(110, time.Minute, true)
+	if got := c.current(); got != 110 {
+		t.Errorf("want no change within the settle window, have %d", got)
+	}
+}
+
+func TestBatchControllerReset(t *testing.T) {
+	c := newBatchController(time.Second, 100, 10, 500)
+	for _, tc := range []struct{ size, want int }{{50, 50}, {1, 10}, {1000, 500}} {
+		c.reset(tc.size)
+		if got := c.current(); got != tc.want {
+			t.Errorf("reset(%d): want %d, have %d", tc.size, tc.want, got)
+		}
+	}
+}
+
+func TestObserveQueued(t *testing.T) {
+	ctx, queued := withQueueTimer(context.Background())
+	ObserveQueued(ctx, 30*time.Millisecond)
+	ObserveQueued(ctx, 20*time.Millisecond)
+	if got := time.Duration(queued.Load()); got != 50*time.Millisecond {
+		t.Errorf("want 50ms queued, have %s", got)
+	}
+	// Without a timer the call is a no-op.
+	ObserveQueued(context.Background(), time.Second)
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// byteBudget bounds the bytes held by the pool across the job queue, worker
+// buffers and pending retries. A limit of zero disables the bound.
+type byteBudget struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	changed chan struct{}
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	return &byteBudget{limit: limit, changed: make(chan struct{})}
+}
+
+// acquire reserves n bytes, blocking while the budget is exhausted. A single
+// message larger than the whole budget is admitted once nothing else is held,
+// so it cannot wedge the partition. It returns false if stop or abort (either
+// may be nil) closes first.
+func (b *byteBudget) acquire(n int64, stop, abort <-chan struct{}) bool {
+	for {
+		b.mu.Lock()
+		if b.limit <= 0 || b.used == 0 || b.used+n <= b.limit {
+			b.used += n
+			b.mu.Unlock()
+			return true
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-stop:
+			return false
+		case <-abort:
+			return false
+		}
+	}
+}
+
+func (b *byteBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	close(b.changed)
+	b.changed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+func (b *byteBudget) inUse() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// messageBytes approximates the memory a message pins: key, value and headers.
+func messageBytes(msg *sarama.ConsumerMessage) int64 {
+	if msg == nil {
+		return 0
+	}
+	n := len(msg.Key) + len(msg.Value)
+	for _, h := range msg.Headers {
+		n += len(h.Key) + len(h.Value)
+	}
+	return int64(n)
+}
@@ -0,0 +1,85 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// DrainReport summarises what an orderly shutdown could not finish. Jobs it
+// counts were never marked, so they are re-read from the last committed
+// offset by whichever member owns the partition next.
+type DrainReport struct {
+	// TimedOut is set when the deadline expired and in-flight writes were
+	// cancelled.
+	TimedOut bool
+	// Discarded counts jobs given up during the drain, mostly pending retries.
+	Discarded int64
+	// Unfinished counts jobs still unaccounted for when Drain returned.
+	Unfinished int64
+	Elapsed    time.Duration
+}
+
+// Drain stops accepting jobs and lets workers write everything already queued
+// or buffered. Writes use the context passed to Start, not ctx, so they are
+// not failed by a shutdown signal; if ctx expires first, in-flight writes are
+// cancelled and Drain returns once workers exit. Pending retries are
+// discarded rather than waited out.
+func (p *Pool) Drain(ctx context.Context) DrainReport {
+	started := time.Now()
+	discardedBefore := p.discarded.Load()
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return DrainReport{}
+	}
+	p.closed = true
+	close(p.done)
+	p.mu.Unlock()
+
+	p.senders.Wait()
+	close(p.jobs)
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	report := DrainReport{}
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		report.TimedOut = true
+		if p.abort != nil {
+			p.abort()
+		}
+		<-finished
+	}
+	// Workers stop reading the queue once the deadline cancels them, and
+	// failures racing the scheduler's exit may have queued late retries.
+	for job := range p.jobs {
+		p.discard(job)
+	}
+	p.discardRetries()
+	if p.abort != nil {
+		p.abort()
+	}
+
+	report.Discarded = p.discarded.Load() - discardedBefore
+	report.Unfinished = p.pending.Load()
+	report.Elapsed = time.Since(started)
+	return report
+}
+
+// settle releases a job that reached a final outcome (written or dropped).
+func (p *Pool) settle(job Job) {
+	p.budget.release(job.bytes)
+	p.pending.Add(-1)
+}
+
+// discard releases a job that will not be written by this member.
+func (p *Pool) discard(job Job) {
+	p.settle(job)
+	p.discarded.Add(1)
+}
@@ -2,18 +2,31 @@ package worker
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/IBM/sarama"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"demo/internal/tracing"
 )
 
+var tracer = otel.Tracer("demo/internal/worker")
+
 // Job wraps a Kafka message together with its consumer session.
 type Job struct {
 	Message  *sarama.ConsumerMessage
 	Session  sarama.ConsumerGroupSession
 	Attempts int
+
+	bytes int64
 }
 
 // Record is the payload handed to the Processor implementation.
@@ -39,8 +52,28 @@ type Options struct {
 	BatchSize   int
 	FlushEvery  time.Duration
 	MaxRetries  int
-	OnError     func(error)
-	OnSuccess   func(batchSize int)
+	// RetryCapacity bounds jobs waiting out their backoff; failing workers
+	// block once it is reached. Backoff doubles from RetryBaseDelay up to
+	// RetryMaxDelay with jitter.
+	RetryCapacity  int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+	// MaxBufferedBytes bounds key, value and header bytes held across the
+	// queue, worker buffers and retries; Submit blocks once it is reached.
+	// Zero means unbounded.
+	MaxBufferedBytes int64
+	// BatchLatencyTarget enables adaptive batch sizing when > 0: BatchSize
+	// becomes the starting point and the pool grows or shrinks batches within
+	// [MinBatchSize, MaxBatchSize] to keep write latency near the target.
+	BatchLatencyTarget time.Duration
+	MinBatchSize       int
+	MaxBatchSize       int
+	OnError            func(error)
+	OnSuccess          func(batchSize int)
+	// OnWritten receives every batch after it has been persisted and marked.
+	OnWritten func(records []Record)
+	// OnDropped receives messages given up after MaxRetries.
+	OnDropped func(msg *sarama.ConsumerMessage)
 }
 
 // Pool fans out Kafka jobs to workers with batching support.
@@ -51,6 +84,40 @@ type Pool struct {
 	wg        sync.WaitGroup
 	mu        sync.RWMutex
 	closed    bool
+	done      chan struct{}
+	senders   sync.WaitGroup
+	budget    *byteBudget
+	retries   *retryQueue
+	batchSeq  atomic.Uint64
+	busy      atomic.Int64
+	pending   atomic.Int64
+	discarded atomic.Int64
+	abort     context.CancelFunc
+	tuning    atomic.Pointer[Tuning]
+	adaptive  *batchController
+	ctx       context.Context
+	workers   map[int]*workerState
+	nextID    int
+}
+
+// workerState is the per-worker handle the pool uses to nudge or retire a
+// worker and observe that its loop is still turning.
+type workerState struct {
+	flush     chan struct{}
+	stop      chan struct{}
+	heartbeat atomic.Int64
+}
+
+// Stats is a point-in-time view of pool utilisation.
+type Stats struct {
+	QueueLength   int   `json:"queue_length"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Workers       int   `json:"workers"`
+	BusyWorkers   int   `json:"busy_workers"`
+	RetryBacklog  int   `json:"retry_backlog"`
+	RetryCapacity int   `json:"retry_capacity"`
+	BufferedBytes int64 `json:"buffered_bytes"`
+	MaxBytes      int64 `json:"max_buffered_bytes"`
 }
 
 // NewPool allocates a pool ready to accept jobs.
@@ -70,64 +137,191 @@ func NewPool(processor Processor, opts Options) *Pool {
 	if opts.MaxRetries <= 0 {
 		opts.MaxRetries = 5
 	}
+	if opts.RetryCapacity <= 0 {
+		opts.RetryCapacity = 10000
+	}
+	if opts.RetryBaseDelay <= 0 {
+		opts.RetryBaseDelay = 100 * time.Millisecond
+	}
+	if opts.RetryMaxDelay < opts.RetryBaseDelay {
+		opts.RetryMaxDelay = 50 * opts.RetryBaseDelay
+	}
 	if opts.OnError == nil {
-		opts.OnError = func(err error) { log.Printf("worker error: %v", err) }
+		opts.OnError = func(error) {}
 	}
 	if opts.OnSuccess == nil {
 		opts.OnSuccess = func(int) {}
 	}
-	return &Pool{
+	if opts.OnWritten == nil {
+		opts.OnWritten = func([]Record) {}
+	}
+	if opts.OnDropped == nil {
+		opts.OnDropped = func(*sarama.ConsumerMessage) {}
+	}
+	p := &Pool{
 		processor: processor,
 		opts:      opts,
 		jobs:      make(chan Job, opts.JobBuffer),
+		done:      make(chan struct{}),
+		budget:    newByteBudget(opts.MaxBufferedBytes),
+		retries:   newRetryQueue(opts.RetryCapacity),
+		workers:   make(map[int]*workerState),
+	}
+	if opts.BatchLatencyTarget > 0 {
+		p.adaptive = newBatchController(opts.BatchLatencyTarget, opts.BatchSize, opts.MinBatchSize, opts.MaxBatchSize)
+	}
+	p.tuning.Store(&Tuning{
+		WorkerCount: opts.WorkerCount,
+		BatchSize:   opts.BatchSize,
+		FlushEvery:  opts.FlushEvery,
+		MaxRetries:  opts.MaxRetries,
+	})
+	return p
+}
+
+// Stats reports queue depth, worker utilisation and pending retries.
+func (p *Pool) Stats() Stats {
+	return Stats{
+		QueueLength:   len(p.jobs),
+		QueueCapacity: cap(p.jobs),
+		Workers:       p.tuning.Load().WorkerCount,
+		BusyWorkers:   int(p.busy.Load()),
+		RetryBacklog:  p.retries.len(),
+		RetryCapacity: p.opts.RetryCapacity,
+		BufferedBytes: p.budget.inUse(),
+		MaxBytes:      p.opts.MaxBufferedBytes,
+	}
+}
+
+// BatchSize returns the size at which workers currently flush, which moves
+// over time when adaptive batch sizing is enabled.
+func (p *Pool) BatchSize() int {
+	if p.adaptive != nil {
+		return p.adaptive.current()
 	}
+	return p.tuning.Load().BatchSize
 }
 
-// Start spins up the configured worker goroutines.
+// Flush asks every worker to write its buffered jobs immediately instead of
+// waiting for the batch size or flush interval.
+func (p *Pool) Flush() {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, w := range p.workers {
+		select {
+		case w.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// StalledWorkers returns the ids of workers whose loop has not completed an
+// iteration within threshold, e.g. because a write is hung.
+func (p *Pool) StalledWorkers(threshold time.Duration) []int {
+	cutoff := time.Now().Add(-threshold).UnixNano()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var stalled []int
+	for id, w := range p.workers {
+		if w.heartbeat.Load() < cutoff {
+			stalled = append(stalled, id)
+		}
+	}
+	sort.Ints(stalled)
+	return stalled
+}
+
+// Start spins up the configured worker goroutines. ctx bounds the writes the
+// workers perform; cancel it only to abandon in-flight writes, and use Drain
+// or Stop for an orderly shutdown.
 func (p *Pool) Start(ctx context.Context) {
-	for i := 0; i < p.opts.WorkerCount; i++ {
-		p.wg.Add(1)
-		go p.runWorker(ctx, i)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctx, p.abort = context.WithCancel(ctx)
+	for i := 0; i < p.tuning.Load().WorkerCount; i++ {
+		p.spawnLocked()
 	}
+	p.wg.Add(1)
+	go p.scheduleRetries()
 }
 
-// Stop waits for workers to finish draining.
+// spawnLocked registers and starts a worker; p.mu must be held.
+func (p *Pool) spawnLocked() {
+	id := p.nextID
+	p.nextID++
+	state := &workerState{flush: make(chan struct{}, 1), stop: make(chan struct{})}
+	state.heartbeat.Store(time.Now().UnixNano())
+	p.workers[id] = state
+	p.wg.Add(1)
+	go p.runWorker(p.ctx, id, state)
+}
+
+// Stop waits, without a deadline, for workers to finish draining.
 func (p *Pool) Stop() {
-	p.mu.Lock()
+	p.Drain(context.Background())
+}
+
+// Submit queues a job for processing, returning false when the pool is
+// shutting down or the job's session ends while waiting for buffer space.
+// It blocks while the byte budget is exhausted, pushing back on the consumer.
+func (p *Pool) Submit(job Job) bool {
+	p.mu.RLock()
 	if p.closed {
-		p.mu.Unlock()
-		return
+		p.mu.RUnlock()
+		return false
+	}
+	p.mu.RUnlock()
+
+	job.bytes = messageBytes(job.Message)
+	var sessionDone <-chan struct{}
+	if job.Session != nil {
+		sessionDone = job.Session.Context().Done()
 	}
-	p.closed = true
-	close(p.jobs)
-	p.mu.Unlock()
-	p.wg.Wait()
+	if !p.budget.acquire(job.bytes, p.done, sessionDone) {
+		return false
+	}
+	p.pending.Add(1)
+	if !p.enqueue(job) {
+		p.budget.release(job.bytes)
+		p.pending.Add(-1)
+		return false
+	}
+	return true
 }
 
-// Submit queues a job for processing, returning false when the pool is shutting down.
-func (p *Pool) Submit(job Job) bool {
+// enqueue hands a job whose bytes are already accounted for to the workers.
+func (p *Pool) enqueue(job Job) bool {
 	p.mu.RLock()
 	if p.closed {
 		p.mu.RUnlock()
 		return false
 	}
+	p.senders.Add(1)
 	p.mu.RUnlock()
+	defer p.senders.Done()
 
 	select {
 	case p.jobs <- job:
 		return true
-	default:
-		p.jobs <- job
-		return true
+	case <-p.done:
+		return false
 	}
 }
 
-func (p *Pool) runWorker(ctx context.Context, id int) {
+func (p *Pool) runWorker(ctx context.Context, id int, state *workerState) {
 	defer p.wg.Done()
 
-	ticker := time.NewTicker(p.opts.FlushEvery)
+	flushEvery := p.tuning.Load().FlushEvery
+	ticker := time.NewTicker(flushEvery)
 	defer ticker.Stop()
 
+	logger := slog.With("worker_id", id)
+	defer func() {
+		p.mu.Lock()
+		delete(p.workers, id)
+		p.mu.Unlock()
+	}()
+
 	var buffer []Job
 
 	flush := func(force bool) {
@@ -151,57 +345,123 @@ func (p *Pool) runWorker(ctx context.Context, id int) {
 			})
 		}
 
-		err := p.processor.ProcessBatch(ctx, records)
+		batchID := p.batchSeq.Add(1)
+		batchCtx, span := tracer.Start(ctx, "worker.batch",
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithLinks(producerLinks(records)...),
+			trace.WithAttributes(
+				semconv.MessagingSystemKafka,
+				semconv.MessagingBatchMessageCount(len(records)),
+				attribute.Int("worker.id", id),
+				attribute.Int64("worker.batch_id", int64(batchID)),
+			),
+		)
+		batchCtx, queued := withQueueTimer(batchCtx)
+		p.busy.Add(1)
+		started := time.Now()
+		err := p.processor.ProcessBatch(batchCtx, records)
+		if p.adaptive != nil {
+			p.adaptive.observe(len(records), time.Since(started)-time.Duration(queued.Load()), err != nil)
+		}
+		p.busy.Add(-1)
 		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		if err != nil {
+			logger.Warn("process batch failed", "batch_id", batchID, "records", len(records), "error", err)
 			for _, job := range buffer {
-				p.handleFailure(ctx, job, err)
+				p.handleFailure(logger.With("batch_id", batchID), job, err)
 			}
 		} else {
 			for _, job := range buffer {
 				job.Session.MarkMessage(job.Message, "")
+				p.settle(job)
 			}
 			p.opts.OnSuccess(len(buffer))
+			p.opts.OnWritten(records)
 		}
 		buffer = buffer[:0]
 	}
 
 	for {
+		state.heartbeat.Store(time.Now().UnixNano())
 		select {
 		case <-ctx.Done():
 			flush(true)
 			return
 		case <-ticker.C:
 			flush(false)
+			if d := p.tuning.Load().FlushEvery; d != flushEvery {
+				flushEvery = d
+				ticker.Reset(d)
+			}
+		case <-state.flush:
+			flush(true)
+		case <-state.stop:
+			flush(true)
+			return
 		case job, ok := <-p.jobs:
 			if !ok {
 				flush(true)
 				return
 			}
 			buffer = append(buffer, job)
-			if len(buffer) >= p.opts.BatchSize {
+			if len(buffer) >= p.BatchSize() {
 				flush(true)
 			}
 		}
 	}
 }
 
-func (p *Pool) handleFailure(ctx context.Context, job Job, cause error) {
+// producerLinks extracts the W3C trace context each producer attached to its
+// record so the batch span can be correlated with every upstream trace.
+func producerLinks(records []Record) []trace.Link {
+	propagator := otel.GetTextMapPropagator()
+	links := make([]trace.Link, 0, len(records))
+	for _, rec := range records {
+		sc := trace.SpanContextFromContext(propagator.Extract(context.Background(), tracing.HeaderCarrier(rec.Headers)))
+		if !sc.IsValid() {
+			continue
+		}
+		links = append(links, trace.Link{
+			SpanContext: sc,
+			Attributes: []attribute.KeyValue{
+				semconv.MessagingDestinationName(rec.Topic),
+				semconv.MessagingKafkaDestinationPartition(int(rec.Partition)),
+				semconv.MessagingKafkaMessageOffset(int(rec.Offset)),
+			},
+		})
+	}
+	return links
+}
+
+func (p *Pool) handleFailure(logger *slog.Logger, job Job, cause error) {
 	p.opts.OnError(cause)
-	if job.Attempts >= p.opts.MaxRetries {
-		log.Printf("dropping message offset=%d attempts=%d: %v", job.Message.Offset, job.Attempts, cause)
+	if job.Attempts >= p.tuning.Load().MaxRetries {
+		logger.Error("dropping message after max retries",
+			"topic", job.Message.Topic,
+			"partition", job.Message.Partition,
+			"offset", job.Message.Offset,
+			"attempt", job.Attempts,
+			"error", cause,
+		)
+		p.settle(job)
+		p.opts.OnDropped(job.Message)
 		return
 	}
+	select {
+	case <-p.done:
+		// Draining: the retry scheduler is gone, leave the job for the next
+		// owner of the partition to re-read.
+		p.discard(job)
+		return
+	default:
+	}
 	job.Attempts++
-	backoff := time.Duration(1<<uint(job.Attempts-1)) * 100 * time.Millisecond
-	if backoff > 5*time.Second {
-		backoff = 5 * time.Second
+	due := time.Now().Add(retryBackoff(job.Attempts, p.opts.RetryBaseDelay, p.opts.RetryMaxDelay))
+	if !p.retries.add(job, due, p.done) {
+		p.discard(job)
 	}
-	go func() {
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(backoff):
-			p.Submit(job)
-		}
-	}()
 }
@@ -0,0 +1,194 @@
+package worker
+
+import (
+	"container/heap"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// retryQueue holds failed jobs until their backoff expires. It is a min-heap
+// on due time drained by a single scheduler goroutine, bounded by capacity so
+// an outage applies backpressure instead of accumulating goroutines.
+type retryQueue struct {
+	mu       sync.Mutex
+	items    retryHeap
+	capacity int
+	wake     chan struct{}
+	space    chan struct{}
+}
+
+type retryItem struct {
+	job Job
+	due time.Time
+}
+
+type retryHeap []retryItem
+
+func (h retryHeap) Len() int           { return len(h) }
+func (h retryHeap) Less(i, j int) bool { return h[i].due.Before(h[j].due) }
+func (h retryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *retryHeap) Push(x any)        { *h = append(*h, x.(retryItem)) }
+func (h *retryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newRetryQueue(capacity int) *retryQueue {
+	return &retryQueue{
+		capacity: capacity,
+		wake:     make(chan struct{}, 1),
+		space:    make(chan struct{}),
+	}
+}
+
+// add schedules job for due, blocking while the queue is at capacity. It
+// returns false if stop closes first.
+func (q *retryQueue) add(job Job, due time.Time, stop <-chan struct{}) bool {
+	for {
+		q.mu.Lock()
+		if len(q.items) < q.capacity {
+			heap.Push(&q.items, retryItem{job: job, due: due})
+			q.mu.Unlock()
+			q.signal()
+			return true
+		}
+		space := q.space
+		q.mu.Unlock()
+
+		select {
+		case <-space:
+		case <-stop:
+			return false
+		}
+	}
+}
+
+// popDue removes every job whose backoff has expired and reports how long
+// until the next one is due (zero when the queue is empty).
+func (q *retryQueue) popDue(now time.Time) ([]Job, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []Job
+	for len(q.items) > 0 && !q.items[0].due.After(now) {
+		due = append(due, heap.Pop(&q.items).(retryItem).job)
+	}
+	if len(due) > 0 {
+		q.freedLocked()
+	}
+	if len(q.items) == 0 {
+		return due, 0
+	}
+	return due, q.items[0].due.Sub(now)
+}
+
+// removeIf drops pending jobs matching fn and returns them.
+func (q *retryQueue) removeIf(fn func(Job) bool) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var removed []Job
+	kept := q.items[:0]
+	for _, item := range q.items {
+		if fn(item.job) {
+			removed = append(removed, item.job)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	q.items = kept
+	heap.Init(&q.items)
+	if len(removed) > 0 {
+		q.freedLocked()
+	}
+	return removed
+}
+
+func (q *retryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *retryQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *retryQueue) freedLocked() {
+	close(q.space)
+	q.space = make(chan struct{})
+}
+
+// retryBackoff returns an exponential delay for attempt with equal jitter:
+// half fixed, half random, so retries from one failed batch spread out.
+func retryBackoff(attempt int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// scheduleRetries feeds due retries back into the job queue until the pool
+// stops. Jobs still pending at that point are released unprocessed.
+func (p *Pool) scheduleRetries() {
+	defer p.wg.Done()
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		jobs, wait := p.retries.popDue(time.Now())
+		for _, job := range jobs {
+			if !p.enqueue(job) {
+				p.discard(job)
+			}
+		}
+		if wait <= 0 {
+			wait = time.Hour
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-p.done:
+			p.discardRetries()
+			return
+		case <-p.retries.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// discardRetries empties the retry queue, returning how many jobs it held.
+func (p *Pool) discardRetries() int {
+	removed := p.retries.removeIf(func(Job) bool { return true })
+	for _, job := range removed {
+		p.discard(job)
+	}
+	return len(removed)
+}
+
+// Revoke discards pending retries for a partition this member no longer
+// owns; the new owner re-reads them from the last committed offset.
+func (p *Pool) Revoke(topic string, partition int32) int {
+	removed := p.retries.removeIf(func(job Job) bool {
+		return job.Message.Topic == topic && job.Message.Partition == partition
+	})
+	for _, job := range removed {
+		p.discard(job)
+	}
+	return len(removed)
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+func retryJob(topic string, partition int32, offset int64) Job {
+	return Job{Message: &sarama.ConsumerMessage{Topic: topic, Partition: partition, Offset: offset}}
+}
+
+func TestRetryQueuePopsInDueOrder(t *testing.T) {
+	q := newRetryQueue(10)
+	now := time.Now()
+	stop := make(chan struct{})
+	for _, tc := range []struct {
+		offset int64
+		due    time.Duration
+	}{{0, 30 * time.Millisecond}, {1, -time.Second}, {2, 10 * time.Millisecond}, {3, -time.Millisecond}} {
+		q.add(retryJob("t", 0, tc.offset), now.Add(tc.due), stop)
+	}
+
+	for _, tc := range []struct {
+		at          time.Duration
+		wantOffsets []int64
+		wantWait    time.Duration
+	}{
+		{at: 0, wantOffsets: []int64{1, 3}, wantWait: 10 * time.Millisecond},
+		{at: 10 * time.Millisecond, wantOffsets: []int64{2}, wantWait: 20 * time.Millisecond},
+		{at: 15 * time.Millisecond, wantOffsets: nil, wantWait: 15 * time.Millisecond},
+		{at: time.Second, wantOffsets: []int64{0}, wantWait: 0},
+	} {
+		jobs, wait := q.popDue(now.Add(tc.at))
+		var offsets []int64
+		for _, job := range jobs {
+			offsets = append(offsets, job.Message.Offset)
+		}
+		if len(offsets) != len(tc.wantOffsets) {
+			t.Fatalf("at +%s: want offsets %v, have %v", tc.at, tc.wantOffsets, offsets)
+		}
+		for i := range offsets {
+			if offsets[i] != tc.wantOffsets[i] {
+				t.Fatalf("at +%s: want offsets %v, have %v", tc.at, tc.wantOffsets, offsets)
+			}
+		}
+		if wait != tc.wantWait {
+			t.Errorf("at +%s: want wait %s, have %s", tc.at, tc.wantWait, wait)
+		}
+	}
+}
+
+func TestRetryQueueBlocksAtCapacity(t *testing.T) {
+	q := newRetryQueue(1)
+	stop := make(chan struct{})
+	now := time.Now()
+	q.add(retryJob("t", 0, 0), now, stop)
+
+	added := make(chan bool)
+	go func() { added <- q.add(retryJob("t", 0, 1), now, stop) }()
+	select {
+	case <-added:
+		t.Fatal("add returned while the queue was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q.popDue(now)
+	select {
+	case ok := <-added:
+		if !ok {
+			t.Fatal("add failed after space was freed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("add still blocked after space was freed")
+	}
+
+	go func() { added <- q.add(retryJob("t", 0, 2), now, stop) }()
+	close(stop)
+	if ok := <-added; ok {
+		t.Error("want add to give up once stopped")
+	}
+}
+
+func TestRetryQueueRemoveIf(t *testing.T) {
+	q := newRetryQueue(10)
+	stop := make(chan struct{})
+	now := time.Now()
+	for i, p := range []int32{0, 1, 0, 1, 2} {
+		q.add(retryJob("t", p, int64(i)), now.Add(time.Duration(i)*time.Millisecond), stop)
+	}
+	removed := q.removeIf(func(job Job) bool { return job.Message.Partition == 1 })
+	if len(removed) != 2 || q.len() != 3 {
+		t.Fatalf("want 2 removed and 3 left, have %d and %d", len(removed), q.len())
+	}
+	jobs, _ := q.popDue(now.Add(time.Second))
+	for i, want := range []int64{0, 2, 4} {
+		if jobs[i].Message.Offset != want {
+			t.Errorf("job %d: want offset %d, have %d", i, want, jobs[i].Message.Offset)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	for _, tc := range []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{30, time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			d := retryBackoff(tc.attempt, base, max)
+			if d < tc.full/2 || d > tc.full {
+				t.Fatalf("attempt %d: want delay in [%s, %s], have %s", tc.attempt, tc.full/2, tc.full, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Tuning holds the pool parameters that can change while the pool runs.
+type Tuning struct {
+	WorkerCount int           `json:"worker_count"`
+	BatchSize   int           `json:"batch_size"`
+	FlushEvery  time.Duration `json:"flush_every"`
+	MaxRetries  int           `json:"max_retries"`
+}
+
+// Tuning returns the parameters currently in effect.
+func (p *Pool) Tuning() Tuning {
+	return *p.tuning.Load()
+}
+
+// Update applies new tuning without restarting the pool. Zero fields keep
+// their current value. With adaptive sizing, a new batch size restarts the
+// controller from that value. Batch size and retry limits apply to the next job each
+// worker handles, flush intervals at the next tick. Surplus workers flush
+// whatever they have buffered before exiting, and jobs still queued are picked
+// up by the remaining workers, so nothing in flight is lost.
+func (p *Pool) Update(t Tuning) {
+	current := p.Tuning()
+	next := current
+	if t.WorkerCount > 0 {
+		next.WorkerCount = t.WorkerCount
+	}
+	if t.BatchSize > 0 {
+		next.BatchSize = t.BatchSize
+	}
+	if t.FlushEvery > 0 {
+		next.FlushEvery = t.FlushEvery
+	}
+	if t.MaxRetries > 0 {
+		next.MaxRetries = t.MaxRetries
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tuning.Store(&next)
+	if p.adaptive != nil && next.BatchSize != current.BatchSize {
+		p.adaptive.reset(next.BatchSize)
+	}
+	if p.ctx != nil && !p.closed {
+		p.resizeLocked(next.WorkerCount)
+	}
+	if next != current {
+		slog.Info("pool tuning updated",
+			"worker_count", next.WorkerCount,
+			"batch_size", next.BatchSize,
+			"flush_every", next.FlushEvery,
+			"max_retries", next.MaxRetries,
+		)
+	}
+}
+
+// resizeLocked starts or retires workers until count are running; p.mu must
+// be held. The newest workers are retired first.
+func (p *Pool) resizeLocked(count int) {
+	for len(p.workers) < count {
+		p.spawnLocked()
+	}
+	if len(p.workers) <= count {
+		return
+	}
+	ids := make([]int, 0, len(p.workers))
+	for id := range p.workers {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	for _, id := range ids[:len(ids)-count] {
+		close(p.workers[id].stop)
+		delete(p.workers, id)
+	}
+}